@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/phpCoder88/geekbrains-go2/duplicate-file-finder/duplicate"
+)
+
+// percent множитель доли в проценты
+const percent = 100
+
+// openHashCache читает кэш хэшей из файла cachePath. Если файла еще нет, создается пустой кэш.
+func openHashCache(cachePath string) (*duplicate.HashCache, error) {
+	file, err := os.Open(cachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return duplicate.NewHashCache(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return duplicate.LoadHashCache(file)
+}
+
+// lockPerm права файла блокировки кэша
+const lockPerm = 0600
+
+// saveHashCache удаляет из кэша записи исчезнувших и изменившихся файлов, перезаписывает файл кэша
+// и выводит статистику использования кэша в stderr. Файл кэша перезаписывается под блокировкой файла
+// cachePath.lock: перед записью в кэш добавляются записи, которые сохранил параллельный запуск.
+func saveHashCache(cachePath string, cache *duplicate.HashCache, fs duplicate.FSReader) error {
+	unlock, err := lockFile(cachePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	saved, err := openHashCache(cachePath)
+	if err != nil {
+		return err
+	}
+	cache.Merge(saved)
+
+	pruned := cache.Prune(fs)
+	stats := cache.Stats()
+	_, _ = fmt.Fprintf(os.Stderr, "Кэш хэшей: попаданий %d из %d (%.1f%%), записей %d, удалено устаревших %d\n",
+		stats.Hits, stats.Hits+stats.Misses, stats.HitRate()*percent, stats.Entries, pruned)
+
+	return writeFileAtomic(cachePath, cache.Save)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/phpCoder88/geekbrains-go2/duplicate-file-finder/duplicate"
+)
+
+// errCompareArgs Ошибка запуска сравнения директорий без исходной и эталонной директорий
+var errCompareArgs = errors.New("subset requires SOURCE and REFERENCE directories")
+
+// confirmCompareMessage вопрос подтверждения удаления файлов исходной директории, которые есть в эталонной
+const confirmCompareMessage = "Удалить файлы исходной директории, которые есть в эталонной(Y/n): "
+
+// runCompare команда subset (diff): сравнивает по содержимому файлы исходной директории с эталонной, выводит файлы,
+// которые уже есть в эталонной директории, и файлы, которые есть только в исходной, и удаляет только совпавшие
+// файлы исходной директории, если указан -remove. Возвращает код выхода программы.
+func runCompare(args []string) int {
+	flags := flag.NewFlagSet("subset", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(flags.Output(), "Usage: %s subset [flags] SOURCE REFERENCE\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	remove := flags.Bool("remove", false, "удалить файлы исходной директории, содержимое которых есть в эталонной. "+
+		"Эталонная директория не изменяется")
+	depth := flags.Int("maxdepth", 0, "максимальная глубина поиска по подкаталогам. --maxdepth <= 0 нет ограничений на вложенность")
+	verifyContent := flags.Bool("verify", false, "побайтово сравнивать каждый файл с файлом эталонной директории перед удалением")
+	journalFile := flags.String("journal", "", "файл журнала, в который дописываются все удаления")
+	format := flags.String("format", "table", "формат вывода: table, json")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		_, _ = fmt.Fprintln(os.Stderr, errCompareArgs)
+		flags.Usage()
+		return exitUsage
+	}
+	source, reference := flags.Arg(0), flags.Arg(1)
+
+	var formatter duplicate.Formatter
+	switch *format {
+	case "table":
+		formatter = duplicate.TableFormatter{}
+	case "json":
+		formatter = duplicate.JSONFormatter{}
+	default:
+		_, _ = fmt.Fprintln(os.Stderr, fmt.Errorf("%q: %w", *format, duplicate.ErrUnknownFormat))
+		return exitUsage
+	}
+
+	logger := newLogger(false)
+	defer func() {
+		_ = logger.Sync()
+	}()
+	logger = logger.With(zap.String("source", source), zap.String("reference", reference))
+
+	opts := []duplicate.Option{duplicate.WithVerify(*verifyContent)}
+	if *journalFile != "" {
+		journal, closer, err := openJournal(*journalFile)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer func() {
+			_ = closer.Close()
+		}()
+
+		opts = append(opts, duplicate.WithJournal(journal))
+	}
+
+	finder := duplicate.NewDuplicateFinder(&duplicate.FileSystem{}, logger, opts...)
+	logger.Info("Start comparing...")
+	ctx, stop := interruptContext(logger)
+	comparison, err := finder.CompareContext(ctx, source, reference, *depth)
+	stop()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if comparison.Incomplete {
+		logger.Warn("Comparison was interrupted, results are incomplete")
+	}
+	hasErrors := reportErrors("Сравнение", comparison.Errors)
+
+	if *format == "json" {
+		err = comparison.WriteJSON(os.Stdout)
+	} else {
+		err = comparison.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if !*remove || len(comparison.Matched) == 0 || comparison.Incomplete {
+		return exitCode(comparison.Incomplete, hasErrors)
+	}
+
+	confirmed, err := confirmAction(bufio.NewReader(os.Stdin), formatter, confirmCompareMessage)
+	if err != nil {
+		logger.Error("Can't scan action confirm message")
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if !confirmed {
+		return exitCode(false, hasErrors)
+	}
+
+	logger.Info("Removing matched files...")
+	ctx, stop = interruptContext(logger)
+	defer stop()
+	applied := finder.RemoveMatchedContext(ctx, comparison)
+
+	return exitCode(applied.Incomplete, hasErrors || reportApplied(logger, applied))
+}
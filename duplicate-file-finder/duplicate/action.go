@@ -0,0 +1,171 @@
+package duplicate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+)
+
+// ErrUnknownAction Ошибка разбора неизвестного действия над дубликатами
+var ErrUnknownAction = errors.New("unknown action")
+
+// ErrCrossDevice Ошибка, обозначающая что дубликат и оставляемый файл находятся на разных устройствах
+var ErrCrossDevice = errors.New("files are on different devices")
+
+// crossDeviceError ошибка файловой системы при обработке файлов на разных устройствах.
+// Ошибка соответствует ErrCrossDevice в errors.Is и сохраняет исходную ошибку для errors.Is и errors.As.
+type crossDeviceError struct {
+	err error
+}
+
+func (e crossDeviceError) Error() string {
+	return e.err.Error() + ": " + ErrCrossDevice.Error()
+}
+
+// Unwrap возвращает исходную ошибку файловой системы
+func (e crossDeviceError) Unwrap() error {
+	return e.err
+}
+
+// Is сопоставляет ошибку с ErrCrossDevice
+func (e crossDeviceError) Is(target error) bool {
+	return target == ErrCrossDevice
+}
+
+// ErrReflinkUnsupported Ошибка, обозначающая что файловая система не поддерживает copy-on-write клоны
+var ErrReflinkUnsupported = errors.New("reflink is not supported by file system")
+
+// Action описывает стратегию обработки дубликата оставляемого файла
+type Action interface {
+	// Apply обрабатывает дубликат file оставляемого файла kept и возвращает путь,
+	// по которому теперь доступно содержимое дубликата, или пустую строку, если дубликат удален
+	Apply(fs FSReadMutator, kept, file File) (string, error)
+	// String возвращает имя действия, используемое во флаге --action
+	String() string
+}
+
+// ParseAction разбирает имя действия над дубликатами
+func ParseAction(name string) (Action, error) {
+	for _, action := range []Action{RemoveAction{}, HardlinkAction{}, SymlinkAction{}, ReflinkAction{}, QuarantineAction{}} {
+		if action.String() == name {
+			return action, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%q: %w", name, ErrUnknownAction)
+}
+
+// RemoveAction удаляет дубликат
+type RemoveAction struct{}
+
+// Apply удаляет дубликат file
+func (RemoveAction) Apply(fs FSReadMutator, _, file File) (string, error) {
+	return "", fs.Remove(file.Path)
+}
+
+func (RemoveAction) String() string {
+	return "remove"
+}
+
+// HardlinkAction заменяет дубликат жесткой ссылкой на оставляемый файл
+type HardlinkAction struct{}
+
+// Apply атомарно заменяет дубликат file жесткой ссылкой на kept
+func (HardlinkAction) Apply(fs FSReadMutator, kept, file File) (string, error) {
+	return kept.Path, replace(fs, file, func(tmpPath string) error {
+		err := fs.Link(kept.Path, tmpPath)
+		if errors.Is(err, syscall.EXDEV) {
+			return crossDeviceError{err: err}
+		}
+
+		return err
+	})
+}
+
+func (HardlinkAction) String() string {
+	return "hardlink"
+}
+
+// SymlinkAction заменяет дубликат символической ссылкой на оставляемый файл.
+// Если Relative равен true, ссылка указывает на оставляемый файл относительно директории дубликата.
+type SymlinkAction struct {
+	Relative bool
+}
+
+// Apply атомарно заменяет дубликат file символической ссылкой на kept.
+// Возвращается содержимое созданной ссылки.
+func (a SymlinkAction) Apply(fs FSReadMutator, kept, file File) (string, error) {
+	target, err := a.target(kept, file)
+	if err != nil {
+		return "", err
+	}
+
+	return target, replace(fs, file, func(tmpPath string) error {
+		return fs.Symlink(target, tmpPath)
+	})
+}
+
+// target возвращает содержимое ссылки на kept, которая заменит дубликат file
+func (a SymlinkAction) target(kept, file File) (string, error) {
+	target, err := filepath.Abs(kept.Path)
+	if err != nil {
+		return "", err
+	}
+
+	if !a.Relative {
+		return target, nil
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(file.Path))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Rel(dir, target)
+}
+
+func (SymlinkAction) String() string {
+	return "symlink"
+}
+
+// ReflinkAction заменяет дубликат copy-on-write клоном оставляемого файла (FICLONE на btrfs, XFS)
+type ReflinkAction struct{}
+
+// Apply атомарно заменяет дубликат file клоном kept
+func (ReflinkAction) Apply(fs FSReadMutator, kept, file File) (string, error) {
+	return kept.Path, replace(fs, file, func(tmpPath string) error {
+		return fs.Reflink(kept.Path, tmpPath)
+	})
+}
+
+func (ReflinkAction) String() string {
+	return "reflink"
+}
+
+// replace атомарно заменяет файл: create создает замену во временном файле рядом с file,
+// который затем переименовывается поверх file
+func replace(fs FSMutator, file File, create func(tmpPath string) error) error {
+	tmpPath := tempPath(file.Path)
+	if err := create(tmpPath); err != nil {
+		return err
+	}
+
+	if err := fs.Rename(tmpPath, file.Path); err != nil {
+		_ = fs.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// tempCounter счетчик для уникальных имен временных файлов
+var tempCounter uint64
+
+// tempPath возвращает путь временного файла в директории файла filePath
+func tempPath(filePath string) string {
+	name := fmt.Sprintf(".%s.dedup-%d-%d", filepath.Base(filePath), os.Getpid(), atomic.AddUint64(&tempCounter, 1))
+	return filepath.Join(filepath.Dir(filePath), name)
+}
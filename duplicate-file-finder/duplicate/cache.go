@@ -0,0 +1,233 @@
+package duplicate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// cacheKey определяет неизменившийся файл: устройство, inode, размер и время изменения
+type cacheKey struct {
+	id      FileID
+	size    int64
+	modTime int64
+}
+
+// CacheEntry описывает запись кэша хэшей. Path - путь, по которому файл был найден последний раз,
+// используется для удаления записей исчезнувших файлов.
+type CacheEntry struct {
+	Path    string `json:"path"`
+	Device  uint64 `json:"dev"`
+	Inode   uint64 `json:"ino"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	Partial string `json:"partial,omitempty"`
+	Full    string `json:"full,omitempty"`
+}
+
+// key возвращает ключ записи
+func (e *CacheEntry) key() cacheKey {
+	return cacheKey{id: FileID{Device: e.Device, Inode: e.Inode}, size: e.Size, modTime: e.ModTime}
+}
+
+// CacheStats описывает использование кэша хэшей
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+}
+
+// HitRate возвращает долю запросов, для которых хэш нашелся в кэше
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// HashCache хранит частичные и полные хэши файлов между запусками. Запись привязана к устройству, inode,
+// размеру и времени изменения файла: если что-то из этого изменилось, хэш считается заново.
+// Файлы, для которых файловая система не сообщает inode, не кэшируются.
+type HashCache struct {
+	mu      sync.Mutex
+	entries map[cacheKey]*CacheEntry
+	hits    int64
+	misses  int64
+}
+
+// NewHashCache создает пустой кэш хэшей
+func NewHashCache() *HashCache {
+	return &HashCache{entries: make(map[cacheKey]*CacheEntry)}
+}
+
+// WithHashCache включает использование кэша хэшей при сравнении по содержимому
+func WithHashCache(cache *HashCache) Option {
+	return func(d *Duplicates) {
+		d.cache = cache
+	}
+}
+
+// LoadHashCache читает кэш хэшей в формате JSON Lines
+func LoadHashCache(r io.Reader) (*HashCache, error) {
+	cache := NewHashCache()
+	err := readJSONLines(r, func(line []byte) error {
+		var entry CacheEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+
+		cache.entries[entry.key()] = &entry
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read hash cache: %w", err)
+	}
+
+	return cache, nil
+}
+
+// Save записывает кэш хэшей в формате JSON Lines
+func (c *HashCache) Save(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writer := newJSONLinesWriter(w)
+	for _, entry := range c.entries {
+		if err := writer.write(entry); err != nil {
+			return fmt.Errorf("write hash cache: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Merge добавляет в кэш записи other, которых в нем нет, и хэши, которых нет в его записях.
+// Позволяет не потерять при сохранении записи, которые сохранил параллельный запуск.
+func (c *HashCache) Merge(other *HashCache) {
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range other.entries {
+		own, ok := c.entries[key]
+		if !ok {
+			c.entries[key] = entry
+			continue
+		}
+
+		if own.Partial == "" {
+			own.Partial = entry.Partial
+		}
+		if own.Full == "" {
+			own.Full = entry.Full
+		}
+	}
+}
+
+// Prune удаляет записи файлов, которые исчезли или изменились, и возвращает количество удаленных записей.
+// Для пути символической ссылки проверяется файл, на который она указывает.
+func (c *HashCache) Prune(fs FSReader) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pruned := 0
+	for key, entry := range c.entries {
+		info, err := fs.Stat(entry.Path)
+		if err == nil {
+			if id, ok := fileID(info); ok && key == newCacheKey(id, info.Size(), info.ModTime().UnixNano()) {
+				continue
+			}
+		}
+
+		delete(c.entries, key)
+		pruned++
+	}
+
+	return pruned
+}
+
+// Stats возвращает статистику использования кэша
+func (c *HashCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: len(c.entries)}
+}
+
+// newCacheKey создает ключ записи кэша
+func newCacheKey(id FileID, size, modTime int64) cacheKey {
+	return cacheKey{id: id, size: size, modTime: modTime}
+}
+
+// lookup возвращает хэш из записи кэша, который выбирает field, и учитывает попадание или промах
+func (c *HashCache) lookup(key cacheKey, field func(entry *CacheEntry) *string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok && *field(entry) != "" {
+		c.hits++
+		return *field(entry), true
+	}
+
+	c.misses++
+	return "", false
+}
+
+// store сохраняет хэш файла path в поле записи кэша, которое выбирает field
+func (c *HashCache) store(key cacheKey, path, hash string, field func(entry *CacheEntry) *string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &CacheEntry{Device: key.id.Device, Inode: key.id.Inode, Size: key.size, ModTime: key.modTime}
+		c.entries[key] = entry
+	}
+
+	entry.Path = path
+	*field(entry) = hash
+}
+
+// partialField выбирает частичный хэш записи кэша
+func partialField(entry *CacheEntry) *string {
+	return &entry.Partial
+}
+
+// fullField выбирает полный хэш записи кэша
+func fullField(entry *CacheEntry) *string {
+	return &entry.Full
+}
+
+// cachedHash возвращает хэш файла из кэша, а если его там нет, считает его функцией hash и сохраняет в кэш.
+// Ключ записи строится по файлу, содержимое которого хэшируется: для символической ссылки - по файлу, на который она указывает.
+func (d *Duplicates) cachedHash(file *File, field func(entry *CacheEntry) *string, hash func() (string, error)) (string, error) {
+	if d.cache == nil {
+		return hash()
+	}
+
+	info, err := d.fs.Stat(file.Path)
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := fileID(info)
+	if !ok {
+		return hash()
+	}
+
+	key := newCacheKey(id, info.Size(), info.ModTime().UnixNano())
+	if cached, hit := d.cache.lookup(key, field); hit {
+		return cached, nil
+	}
+
+	result, err := hash()
+	if err != nil {
+		return "", err
+	}
+	d.cache.store(key, file.Path, result, field)
+
+	return result, nil
+}
@@ -0,0 +1,264 @@
+package duplicate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// ErrRootsOverlap Ошибка сравнения директорий, одна из которых находится внутри другой
+var ErrRootsOverlap = errors.New("source and reference directories overlap")
+
+// MatchedFile описывает файл исходной директории, содержимое которого есть в эталонной директории
+type MatchedFile struct {
+	File File
+	// Reference файл эталонной директории с тем же содержимым
+	Reference File
+}
+
+// Comparison описывает результат сравнения исходной директории с эталонной
+type Comparison struct {
+	Source    string
+	Reference string
+	// Matched файлы исходной директории, содержимое которых есть в эталонной директории
+	Matched []MatchedFile
+	// Unique файлы исходной директории, содержимого которых нет в эталонной директории
+	Unique     []File
+	Incomplete bool
+	Errors     PathErrors
+}
+
+// MatchedBytes возвращает размер файлов исходной директории, содержимое которых есть в эталонной
+func (c *Comparison) MatchedBytes() int64 {
+	var bytes int64
+	for _, matched := range c.Matched {
+		bytes += matched.File.Size
+	}
+
+	return bytes
+}
+
+// UniqueBytes возвращает размер файлов, которые есть только в исходной директории
+func (c *Comparison) UniqueBytes() int64 {
+	var bytes int64
+	for _, file := range c.Unique {
+		bytes += file.Size
+	}
+
+	return bytes
+}
+
+// CompareContext сравнивает файлы исходной директории source с файлами эталонной директории reference,
+// пока не отменен контекст ctx. Файлы сравниваются по SHA-256 содержимого независимо от WithMatch,
+// а в группах дубликатов остаются файлы эталонной директории. Жесткая ссылка на файл эталонной директории
+// тоже считается совпадением. Директории с раскрытыми символическими ссылками не должны находиться
+// одна внутри другой. С WithFollowSymlinks совпадением считается только файл эталонной директории,
+// найденный не по символической ссылке и находящийся вне исходной директории, а файлы исходной директории,
+// которые на самом деле находятся в эталонной, пропускаются.
+func (d *Duplicates) CompareContext(ctx context.Context, source, reference string, maxDepth int) (*Comparison, error) {
+	keepReference, err := NewKeepInRoot(reference)
+	if err != nil {
+		return nil, err
+	}
+	workDir := keepReference.workDir
+
+	sourceAbs, referenceAbs := absPath(workDir, d.realRoot(source)), absPath(workDir, d.realRoot(reference))
+	if insideDir(sourceAbs, referenceAbs) || insideDir(referenceAbs, sourceAbs) {
+		return nil, fmt.Errorf("%q, %q: %w", source, reference, ErrRootsOverlap)
+	}
+
+	// Стартовые директории записываются в File.Root в том же виде, что и в newSeekRoots
+	sourceRoot, referenceRoot := path.Clean(source), path.Clean(reference)
+
+	d.match = MatchContent
+	d.keep = KeepPolicies{keepReference, d.keep}
+	result := d.SeekRootsContext(ctx, []string{source, reference}, maxDepth)
+
+	comparison := &Comparison{Source: source, Reference: reference, Incomplete: result.Incomplete, Errors: result.Errors}
+
+	// outside проверяет, что файл с раскрытыми символическими ссылками находится вне директории dir.
+	// Без перехода по ссылкам файлы находятся в своих стартовых директориях, которые уже проверены.
+	outside := func(file File, dir string) bool {
+		if !d.followSymlinks {
+			return true
+		}
+
+		real, err := d.realPath(file.Path)
+		if err != nil {
+			comparison.Errors = append(comparison.Errors, d.pathError(OpFollow, file.Path, err))
+			return false
+		}
+
+		return !insideDir(dir, absPath(workDir, real))
+	}
+
+	witnesses := make(map[string]bool)
+	references := make(map[FileID]File)
+	for _, file := range d.scanned {
+		if file.Root != referenceRoot || file.Symlink || !outside(file, sourceAbs) {
+			continue
+		}
+
+		witnesses[file.Path] = true
+		if file.ID != (FileID{}) {
+			references[file.ID] = file
+		}
+	}
+
+	matches := make(map[string]File)
+	for _, files := range d.files {
+		for _, witness := range files {
+			if !witnesses[witness.Path] {
+				continue
+			}
+
+			for _, file := range files {
+				matches[file.Path] = witness
+			}
+			break
+		}
+	}
+
+	for _, file := range d.scanned {
+		if file.Root != sourceRoot {
+			continue
+		}
+		if !outside(file, referenceAbs) {
+			d.logger.Warn("Skip source file inside reference directory " + file.Path)
+			continue
+		}
+
+		ref, ok := matches[file.Path]
+		if !ok && file.ID != (FileID{}) {
+			ref, ok = references[file.ID]
+		}
+		if ok {
+			comparison.Matched = append(comparison.Matched, MatchedFile{File: file, Reference: ref})
+		} else {
+			comparison.Unique = append(comparison.Unique, file)
+		}
+	}
+
+	sort.Slice(comparison.Matched, func(i, j int) bool {
+		return comparison.Matched[i].File.Path < comparison.Matched[j].File.Path
+	})
+	sort.Slice(comparison.Unique, func(i, j int) bool {
+		return comparison.Unique[i].Path < comparison.Unique[j].Path
+	})
+
+	return comparison, nil
+}
+
+// realRoot возвращает стартовую директорию с раскрытыми символическими ссылками. Если путь не раскрывается,
+// директория возвращается без изменений, а ошибка сообщается при ее сканировании.
+func (d *Duplicates) realRoot(root string) string {
+	real, err := d.realPath(root)
+	if err != nil {
+		return root
+	}
+
+	return real
+}
+
+// RemoveMatchedContext удаляет файлы исходной директории, содержимое которых есть в эталонной директории,
+// пока не отменен контекст ctx. Файлы эталонной директории не изменяются. С WithVerify каждый файл
+// перед удалением побайтово сравнивается с файлом эталонной директории.
+func (d *Duplicates) RemoveMatchedContext(ctx context.Context, comparison *Comparison) *RemoveResult {
+	reviews := make(map[string]Review)
+	for _, matched := range comparison.Matched {
+		review := reviews[matched.Reference.Path]
+		review.Kept = []File{matched.Reference}
+		review.Duplicates = append(review.Duplicates, matched.File)
+		reviews[matched.Reference.Path] = review
+	}
+
+	return d.applyReviews(ctx, RemoveAction{}, reviews)
+}
+
+// WriteTable выводит таблицы совпавших и уникальных файлов исходной директории и итоги сравнения
+func (c *Comparison) WriteTable(out io.Writer) error {
+	if len(c.Matched) > 0 {
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t\n", "Matched File", "Reference File", "File Size")
+		for _, matched := range c.Matched {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t\n", matched.File.Path, matched.Reference.Path, matched.File.Size)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(out)
+	}
+
+	if len(c.Unique) > 0 {
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t\n", "Unique File", "File Size")
+		for _, file := range c.Unique {
+			_, _ = fmt.Fprintf(w, "%s\t%d\t\n", file.Path, file.Size)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(out)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	_, _ = fmt.Fprintf(w, "%s\t%s\t\n", "Source", filepath.Clean(c.Source))
+	_, _ = fmt.Fprintf(w, "%s\t%s\t\n", "Reference", filepath.Clean(c.Reference))
+	_, _ = fmt.Fprintf(w, "%s\t%d\t\n", "Matched Files", len(c.Matched))
+	_, _ = fmt.Fprintf(w, "%s\t%s\t\n", "Matched Size", FormatBytes(c.MatchedBytes()))
+	_, _ = fmt.Fprintf(w, "%s\t%d\t\n", "Unique Files", len(c.Unique))
+	_, _ = fmt.Fprintf(w, "%s\t%s\t\n", "Unique Size", FormatBytes(c.UniqueBytes()))
+
+	return w.Flush()
+}
+
+// jsonMatchedFile описывает совпавший файл исходной директории в JSON выводе
+type jsonMatchedFile struct {
+	Path      string `json:"path"`
+	Reference string `json:"reference"`
+	Size      int64  `json:"size"`
+}
+
+// jsonUniqueFile описывает уникальный файл исходной директории в JSON выводе
+type jsonUniqueFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// jsonComparison описывает результат сравнения директорий в JSON выводе
+type jsonComparison struct {
+	Source       string            `json:"source"`
+	Reference    string            `json:"reference"`
+	Matched      []jsonMatchedFile `json:"matched"`
+	Unique       []jsonUniqueFile  `json:"unique"`
+	MatchedBytes int64             `json:"matchedBytes"`
+	UniqueBytes  int64             `json:"uniqueBytes"`
+}
+
+// WriteJSON выводит результат сравнения одним JSON документом
+func (c *Comparison) WriteJSON(out io.Writer) error {
+	result := jsonComparison{
+		Source:       c.Source,
+		Reference:    c.Reference,
+		Matched:      make([]jsonMatchedFile, len(c.Matched)),
+		Unique:       make([]jsonUniqueFile, len(c.Unique)),
+		MatchedBytes: c.MatchedBytes(),
+		UniqueBytes:  c.UniqueBytes(),
+	}
+	for ind, matched := range c.Matched {
+		result.Matched[ind] = jsonMatchedFile{Path: matched.File.Path, Reference: matched.Reference.Path, Size: matched.File.Size}
+	}
+	for ind, file := range c.Unique {
+		result.Unique[ind] = jsonUniqueFile{Path: file.Path, Size: file.Size}
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
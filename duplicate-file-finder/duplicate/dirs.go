@@ -0,0 +1,598 @@
+package duplicate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDirChanged Ошибка, обозначающая что содержимое директории изменилось после поиска
+var ErrDirChanged = errors.New("directory changed after search")
+
+// DirGroup описывает группу одинаковых директорий: в них одинаковые относительные пути файлов,
+// а файлы с одним путем - дубликаты друг друга. Первая директория остается по правилам WithKeepPolicy,
+// остальные - дубликаты.
+type DirGroup struct {
+	Hash string
+	Dirs []string
+	// Files количество файлов в каждой директории вместе с поддиректориями
+	Files int
+	// Bytes размер файлов каждой директории вместе с поддиректориями
+	Bytes int64
+}
+
+// WastedBytes возвращает объем, который освободится после удаления директорий-дубликатов
+func (g DirGroup) WastedBytes() int64 {
+	return g.Bytes * int64(len(g.Dirs)-1)
+}
+
+// DirSubset описывает директорию Dir, каждый файл которой есть по тому же относительному пути в большей директории Superset
+type DirSubset struct {
+	Dir      string
+	Superset string
+	// Files количество файлов директории Dir вместе с поддиректориями
+	Files int
+	// Bytes размер файлов директории Dir вместе с поддиректориями
+	Bytes int64
+}
+
+// WithDirs включает поиск одинаковых директорий и директорий, которые являются подмножеством других.
+// Директории сравниваются по хэшу, который строится от файлов и поддиректорий как дерево Меркла.
+// Файлы сравниваются выбранным способом WithMatch.
+func WithDirs(dirs bool) Option {
+	return func(d *Duplicates) {
+		d.dirs = dirs
+	}
+}
+
+// dirNode директория, в которой найдены файлы
+type dirNode struct {
+	path     string
+	root     string
+	parent   *dirNode
+	children map[string]*dirNode
+	// files файлы, найденные непосредственно в директории
+	files []File
+	// hash хэш директории, построенный от имен и ключей групп файлов и хэшей поддиректорий
+	hash string
+	// unique в директории или поддиректориях есть файл, у которого нет дубликатов
+	unique  bool
+	count   int
+	bytes   int64
+	modTime time.Time
+}
+
+// dirFile возвращает директорию в виде файла, чтобы применить к ней правила выбора оставляемого файла
+func (n *dirNode) dirFile() File {
+	return File{Name: filepath.Base(n.path), Path: n.path, Root: n.root, Size: n.bytes, ModTime: n.modTime}
+}
+
+// isAncestor возвращает true, если директория n находится внутри other
+func (n *dirNode) isAncestor(other *dirNode) bool {
+	for parent := n.parent; parent != nil; parent = parent.parent {
+		if parent == other {
+			return true
+		}
+	}
+
+	return false
+}
+
+// walkFiles вызывает fn для каждого файла директории и поддиректорий с путем относительно директории
+func (n *dirNode) walkFiles(prefix string, fn func(rel string, file File)) {
+	for _, file := range n.files {
+		fn(filepath.Join(prefix, file.Name), file)
+	}
+	for name, child := range n.children {
+		child.walkFiles(filepath.Join(prefix, name), fn)
+	}
+}
+
+// computeHash считает хэш директории после хэшей поддиректорий. tokens - ключи групп файлов, у которых есть дубликаты.
+func (n *dirNode) computeHash(tokens map[string]string) {
+	lines := make([]string, 0, len(n.files)+len(n.children))
+	for _, file := range n.files {
+		token, ok := tokens[file.Path]
+		if !ok {
+			n.unique = true
+			token = "unique\x00" + file.Path
+		}
+		lines = append(lines, "f\x00"+file.Name+"\x00"+token)
+
+		n.count++
+		n.bytes += file.Size
+		if file.ModTime.After(n.modTime) {
+			n.modTime = file.ModTime
+		}
+	}
+
+	for name, child := range n.children {
+		child.computeHash(tokens)
+		lines = append(lines, "d\x00"+name+"\x00"+child.hash)
+
+		n.unique = n.unique || child.unique
+		n.count += child.count
+		n.bytes += child.bytes
+		if child.modTime.After(n.modTime) {
+			n.modTime = child.modTime
+		}
+	}
+
+	sort.Strings(lines)
+	hash := sha256.New()
+	for _, line := range lines {
+		_, _ = hash.Write([]byte(line + "\n"))
+	}
+	n.hash = hex.EncodeToString(hash.Sum(nil))
+}
+
+// findDirs строит дерево директорий найденных файлов, ищет одинаковые директории и директории-подмножества.
+// Вызывается после группировки файлов и до удаления из групп ссылок на оставляемые файлы.
+func (d *Duplicates) findDirs() {
+	tokens := make(map[string]string)
+	byToken := make(map[string][]string)
+	for key, files := range d.files {
+		if len(files) < minGroupSize {
+			continue
+		}
+		for _, file := range files {
+			tokens[file.Path] = key
+			byToken[key] = append(byToken[key], file.Path)
+		}
+	}
+
+	d.dirNodes = make(map[string]*dirNode)
+	for _, file := range d.scanned {
+		node := d.dirNode(filepath.Dir(file.Path), file.Root)
+		node.files = append(node.files, file)
+	}
+	for _, node := range d.dirNodes {
+		if node.parent == nil {
+			node.computeHash(tokens)
+		}
+	}
+
+	byHash := make(map[string][]*dirNode)
+	for _, node := range d.dirNodes {
+		if !node.unique && node.count > 0 {
+			byHash[node.hash] = append(byHash[node.hash], node)
+		}
+	}
+	d.dirsByHash = byHash
+
+	d.dirGroups = d.identicalDirs(byHash)
+	d.dirSubsets = d.subsetDirs(tokens, byToken)
+}
+
+// dirNode возвращает узел директории dir стартовой директории root, создавая его и родительские узлы
+// до стартовой директории
+func (d *Duplicates) dirNode(dir, root string) *dirNode {
+	if node, ok := d.dirNodes[dir]; ok {
+		return node
+	}
+
+	node := &dirNode{path: dir, root: root, children: make(map[string]*dirNode)}
+	d.dirNodes[dir] = node
+
+	parentDir := filepath.Dir(dir)
+	if dir == root || parentDir == dir {
+		return node
+	}
+
+	parent := d.dirNode(parentDir, root)
+	parent.children[filepath.Base(dir)] = node
+	node.parent = parent
+
+	return node
+}
+
+// identicalDirs возвращает группы одинаковых директорий. Группа не выводится, если ее директории
+// находятся внутри одинаковых директорий: о них уже сообщает группа родительских директорий.
+func (d *Duplicates) identicalDirs(byHash map[string][]*dirNode) []DirGroup {
+	var groups []DirGroup
+	for hash, nodes := range byHash {
+		if len(nodes) < minGroupSize {
+			continue
+		}
+
+		if nestedDirGroup(nodes, byHash) {
+			continue
+		}
+
+		dirFiles := make([]File, len(nodes))
+		for ind, node := range nodes {
+			dirFiles[ind] = node.dirFile()
+		}
+		sort.Sort(byKeepPolicy{files: dirFiles, policy: d.keep})
+
+		group := DirGroup{Hash: hash, Files: nodes[0].count, Bytes: nodes[0].bytes}
+		for _, file := range dirFiles {
+			group.Dirs = append(group.Dirs, file.Path)
+		}
+		groups = append(groups, group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].WastedBytes() != groups[j].WastedBytes() {
+			return groups[i].WastedBytes() > groups[j].WastedBytes()
+		}
+		return groups[i].Dirs[0] < groups[j].Dirs[0]
+	})
+
+	return groups
+}
+
+// nestedDirGroup возвращает true, если одинаковые директории nodes - это по одной поддиректории с одним именем
+// в каждой директории группы одинаковых родительских директорий
+func nestedDirGroup(nodes []*dirNode, byHash map[string][]*dirNode) bool {
+	first := nodes[0]
+	if first.parent == nil || len(byHash[first.parent.hash]) != len(nodes) {
+		return false
+	}
+
+	for _, node := range nodes {
+		if node.parent == nil || node.parent.hash != first.parent.hash || filepath.Base(node.path) != filepath.Base(first.path) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// subsetDirs возвращает директории, каждый файл которых есть по тому же относительному пути в большей директории.
+// Для директории выбирается наименьшая такая директория. Директория не выводится, если ее родительская директория
+// уже является подмножеством родительской директории надмножества.
+func (d *Duplicates) subsetDirs(tokens map[string]string, byToken map[string][]string) []DirSubset {
+	supersets := make(map[*dirNode]*dirNode)
+	for _, node := range d.dirNodes {
+		if node.unique || node.count == 0 {
+			continue
+		}
+		if superset := d.superset(node, tokens, byToken); superset != nil {
+			supersets[node] = d.keptTwin(superset, node)
+		}
+	}
+
+	var subsets []DirSubset
+	for node, superset := range supersets {
+		if node.parent != nil && superset.parent != nil && supersets[node.parent] == superset.parent &&
+			filepath.Base(node.path) == filepath.Base(superset.path) {
+			continue
+		}
+
+		subsets = append(subsets, DirSubset{Dir: node.path, Superset: superset.path, Files: node.count, Bytes: node.bytes})
+	}
+
+	sort.Slice(subsets, func(i, j int) bool {
+		if subsets[i].Bytes != subsets[j].Bytes {
+			return subsets[i].Bytes > subsets[j].Bytes
+		}
+		return subsets[i].Dir < subsets[j].Dir
+	})
+
+	return subsets
+}
+
+// keptTwin возвращает директорию, которая остается по правилам WithKeepPolicy среди node и одинаковых с ней директорий.
+// Директории, в которых находится subset или которые находятся в нем, не выбираются.
+func (d *Duplicates) keptTwin(node, subset *dirNode) *dirNode {
+	var dirFiles []File
+	for _, twin := range d.dirsByHash[node.hash] {
+		if !related(twin, subset) {
+			dirFiles = append(dirFiles, twin.dirFile())
+		}
+	}
+	if len(dirFiles) < minGroupSize {
+		return node
+	}
+
+	sort.Sort(byKeepPolicy{files: dirFiles, policy: d.keep})
+
+	return d.dirNodes[dirFiles[0].Path]
+}
+
+// related возвращает true, если одна из директорий находится внутри другой
+func related(a, b *dirNode) bool {
+	return a.isAncestor(b) || b.isAncestor(a)
+}
+
+// superset возвращает наименьшую директорию, в которой есть каждый файл директории node по тому же относительному пути.
+// Кандидаты - директории дубликатов любого файла node. Возвращает nil, если такой директории нет.
+func (d *Duplicates) superset(node *dirNode, tokens map[string]string, byToken map[string][]string) *dirNode {
+	type entry struct {
+		rel, token string
+	}
+	var entries []entry
+	node.walkFiles("", func(rel string, file File) {
+		entries = append(entries, entry{rel: rel, token: tokens[file.Path]})
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].rel < entries[j].rel
+	})
+
+	first := entries[0]
+	suffix := string(filepath.Separator) + first.rel
+	var best *dirNode
+	for _, candidatePath := range byToken[first.token] {
+		var dir string
+		switch {
+		case candidatePath == first.rel:
+			dir = "."
+		case strings.HasSuffix(candidatePath, suffix):
+			dir = strings.TrimSuffix(candidatePath, suffix)
+		default:
+			continue
+		}
+
+		candidate, ok := d.dirNodes[dir]
+		if !ok || candidate == node || candidate.count <= node.count || related(node, candidate) {
+			continue
+		}
+		if best != nil && (candidate.count > best.count || candidate.count == best.count && candidate.path > best.path) {
+			continue
+		}
+
+		contains := true
+		for _, e := range entries {
+			if token, ok := tokens[filepath.Join(candidate.path, e.rel)]; !ok || token != e.token {
+				contains = false
+				break
+			}
+		}
+		if contains {
+			best = candidate
+		}
+	}
+
+	return best
+}
+
+// removableDirs возвращает директории, которые можно удалить целиком, и директории, содержимое которых
+// при этом остается: для директорий-дубликатов - остальные директории группы, для подмножеств - надмножество
+// и одинаковые с ним директории
+func (d *Duplicates) removableDirs() map[string][]string {
+	witnesses := make(map[string][]string)
+	for _, group := range d.dirGroups {
+		for ind, dir := range group.Dirs[1:] {
+			others := append(append([]string{}, group.Dirs[:ind+1]...), group.Dirs[ind+2:]...)
+			witnesses[dir] = append(witnesses[dir], others...)
+		}
+	}
+
+	for _, subset := range d.dirSubsets {
+		witnesses[subset.Dir] = append(witnesses[subset.Dir], subset.Superset)
+		superset := d.dirNodes[subset.Superset]
+		for _, twin := range d.dirsByHash[superset.hash] {
+			if twin != superset && !related(twin, d.dirNodes[subset.Dir]) {
+				witnesses[subset.Dir] = append(witnesses[subset.Dir], twin.path)
+			}
+		}
+	}
+
+	return witnesses
+}
+
+// planDirRemoval выбирает директории для удаления так, чтобы содержимое каждой удаленной директории осталось
+// хотя бы в одной неудаляемой директории. Возвращает удаляемые директории и директорию, в которой остается их содержимое.
+// Директории внутри удаляемых директорий отдельно не удаляются.
+func (d *Duplicates) planDirRemoval() map[string]string {
+	witnesses := d.removableDirs()
+	removed := make(map[string]bool, len(witnesses))
+	for dir := range witnesses {
+		removed[dir] = true
+	}
+
+	survives := func(dir string) bool {
+		for node := d.dirNodes[dir]; node != nil; node = node.parent {
+			if removed[node.path] {
+				return false
+			}
+		}
+		return true
+	}
+	survivor := func(dir string) string {
+		for _, witness := range witnesses[dir] {
+			if survives(witness) {
+				return witness
+			}
+		}
+		return ""
+	}
+
+	// Отказ от удаления директории только добавляет выживших, поэтому цикл заканчивается
+	for changed := true; changed; {
+		changed = false
+		for dir := range removed {
+			if survivor(dir) == "" {
+				delete(removed, dir)
+				changed = true
+			}
+		}
+	}
+
+	plan := make(map[string]string, len(removed))
+	for dir := range removed {
+		nested := false
+		for node := d.dirNodes[dir].parent; node != nil; node = node.parent {
+			if removed[node.path] {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			plan[dir] = survivor(dir)
+		}
+	}
+
+	return plan
+}
+
+// RemoveDirsContext удаляет целиком директории-дубликаты и директории-подмножества, найденные с WithDirs,
+// пока не отменен контекст ctx. Директория удаляется, только если ее содержимое остается в другой директории,
+// которая не удаляется. Перед удалением директория сверяется с результатами поиска: если в ней появились,
+// исчезли или изменились файлы, она пропускается с ошибкой ErrDirChanged. С WithVerify или если файлы
+// сравнивались не по содержимому, каждый файл дополнительно побайтово сравнивается с файлом по тому же пути
+// в остающейся директории, и директория с отличающимся файлом пропускается с ошибкой ErrContentMismatch.
+// Проверенная директория сначала переименовывается во временную рядом с ней и только затем удаляется,
+// поэтому ошибка удаления не оставляет ее на месте частично удаленной: оставшиеся файлы остаются
+// во временной директории, путь к которой указан в ошибке.
+func (d *Duplicates) RemoveDirsContext(ctx context.Context) *RemoveResult {
+	result := &RemoveResult{}
+	plan := d.planDirRemoval()
+	dirs := make([]string, 0, len(plan))
+	for dir := range plan {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	atomic.StoreInt64(&d.progress.duplicates, int64(len(dirs)))
+	atomic.StoreInt64(&d.progress.processed, 0)
+	d.progress.setStage(ProgressApply)
+	stopProgress := d.startProgress()
+	defer stopProgress()
+
+	for _, dir := range dirs {
+		if ctx.Err() != nil {
+			result.Incomplete = true
+			break
+		}
+
+		node := d.dirNodes[dir]
+		kept := d.dirNodes[plan[dir]]
+		if err := d.removeDir(ctx, node, kept); err != nil {
+			if ctx.Err() != nil {
+				result.Incomplete = true
+				break
+			}
+
+			var pathErr *PathError
+			if errors.As(err, &pathErr) {
+				result.Errors = append(result.Errors, pathErr)
+				continue
+			}
+
+			d.logger.Warn("Skip removing dir " + dir)
+			result.Skipped = append(result.Skipped, SkippedFile{File: node.dirFile(), Kept: kept.dirFile(), Reason: err})
+			continue
+		}
+
+		atomic.AddInt64(&d.progress.processed, 1)
+		result.Removed = append(result.Removed, node.dirFile())
+		if d.journal != nil {
+			if err := d.journal.Record(node.hash, RemoveAction{}, kept.dirFile(), node.dirFile(), ""); err != nil {
+				result.Errors = append(result.Errors, d.pathError(OpJournal, dir, err))
+			}
+		}
+	}
+
+	return result
+}
+
+// removeDir сверяет директорию node с результатами поиска и удаляет ее файлы и поддиректории.
+// Ошибки сверки возвращаются как есть, ошибки удаления - как PathError.
+func (d *Duplicates) removeDir(ctx context.Context, node, kept *dirNode) error {
+	expected := make(map[string]File, node.count)
+	node.walkFiles(node.path, func(_ string, file File) {
+		expected[file.Path] = file
+	})
+
+	var files, dirs []string
+	if err := d.listDir(node.path, expected, &files, &dirs); err != nil {
+		return err
+	}
+	if len(files) != len(expected) {
+		return fmt.Errorf("%s: %d files, want %d: %w", node.path, len(files), len(expected), ErrDirChanged)
+	}
+
+	// Совпадение имени и размера не гарантирует одинаковое содержимое, поэтому без сравнения по содержимому
+	// директория удаляется только после побайтовой проверки
+	if d.verify || d.match != MatchContent {
+		for _, filePath := range files {
+			rel, err := filepath.Rel(node.path, filePath)
+			if err != nil {
+				return err
+			}
+			if err = d.compareContent(ctx, File{Path: filepath.Join(kept.path, rel)}, File{Path: filePath}); err != nil {
+				return err
+			}
+		}
+	}
+
+	d.logger.Info("Removing dir " + node.path)
+	removing, err := d.removingPath(node.path)
+	if err != nil {
+		return d.pathError(RemoveAction{}.String(), node.path, err)
+	}
+	if err = d.fs.Rename(node.path, removing); err != nil {
+		return d.pathError(RemoveAction{}.String(), node.path, err)
+	}
+
+	for _, name := range append(files, dirs...) {
+		var rel string
+		if rel, err = filepath.Rel(node.path, name); err != nil {
+			return err
+		}
+		if err = d.fs.Remove(filepath.Join(removing, rel)); err != nil {
+			d.logger.Warn("Dir " + node.path + " is moved to " + removing + " but not removed")
+			return d.pathError(RemoveAction{}.String(), filepath.Join(removing, rel), err)
+		}
+	}
+
+	return nil
+}
+
+// removingPath возвращает свободный путь рядом с директорией dirPath, в который она переносится перед удалением
+func (d *Duplicates) removingPath(dirPath string) (string, error) {
+	base := filepath.Join(filepath.Dir(dirPath), fmt.Sprintf(".%s.removing-%d", filepath.Base(dirPath), os.Getpid()))
+	target := base
+	for i := 1; ; i++ {
+		_, err := d.fs.Lstat(target)
+		if errors.Is(err, os.ErrNotExist) {
+			return target, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		target = fmt.Sprintf("%s.%d", base, i)
+	}
+}
+
+// listDir читает директорию dirPath с поддиректориями и проверяет, что каждый файл в ней найден при поиске
+// и не изменился. Добавляет пути файлов в files, пути директорий - в dirs, вложенные директории раньше родительских.
+func (d *Duplicates) listDir(dirPath string, expected map[string]File, files, dirs *[]string) error {
+	list, err := d.fs.ReadDir(dirPath)
+	if err != nil {
+		return d.pathError(OpReadDir, dirPath, err)
+	}
+
+	for _, entry := range list {
+		entryPath := filepath.Join(dirPath, entry.Name())
+		switch {
+		case entry.IsDir():
+			if err = d.listDir(entryPath, expected, files, dirs); err != nil {
+				return err
+			}
+		case entry.Mode().IsRegular():
+			file, ok := expected[entryPath]
+			if !ok || file.Symlink || file.Size != entry.Size() || !file.ModTime.Equal(entry.ModTime()) {
+				return fmt.Errorf("%s: %w", entryPath, ErrDirChanged)
+			}
+			*files = append(*files, entryPath)
+		default:
+			return fmt.Errorf("%s: %w", entryPath, ErrDirChanged)
+		}
+	}
+
+	*dirs = append(*dirs, dirPath)
+
+	return nil
+}
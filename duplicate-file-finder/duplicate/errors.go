@@ -0,0 +1,74 @@
+package duplicate
+
+import (
+	"errors"
+	"os"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// ErrFileVanished Ошибка, обозначающая что найденный при обходе файл исчез до того, как его успели обработать
+var ErrFileVanished = errors.New("file vanished")
+
+// Операции, при выполнении которых возникают ошибки PathError.
+// При обработке дубликатов операцией считается имя действия: remove, hardlink и т.д.
+const (
+	OpReadDir = "readdir"
+	OpIgnore  = "ignore"
+	OpFollow  = "follow"
+	OpHash    = "hash"
+	OpJournal = "journal"
+)
+
+// PathError описывает ошибку операции Op над путем Path.
+// Ошибка поддерживает errors.Is и errors.As: например, errors.Is(err, os.ErrPermission) или errors.Is(err, os.ErrNotExist).
+// Если файл, найденный при обходе, исчез к моменту хэширования или обработки, ошибка также соответствует ErrFileVanished.
+type PathError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap возвращает исходную ошибку
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// Is сопоставляет ошибку отсутствия файла после обхода с ErrFileVanished
+func (e *PathError) Is(target error) bool {
+	return target == ErrFileVanished && e.Op != OpReadDir && e.Op != OpIgnore && errors.Is(e.Err, os.ErrNotExist)
+}
+
+// PathErrors список ошибок обработки путей
+type PathErrors []*PathError
+
+// Err объединяет ошибки в одну, которая поддерживает errors.Is и errors.As. Если ошибок нет, возвращает nil.
+func (e PathErrors) Err() error {
+	var err error
+	for _, pathErr := range e {
+		err = multierr.Append(err, pathErr)
+	}
+
+	return err
+}
+
+// pathError логирует ошибку операции op над путем path и возвращает ее в виде PathError
+func (d *Duplicates) pathError(op, path string, err error) *PathError {
+	d.logger.Error("Can't "+op+" "+path, zap.Error(err))
+
+	return &PathError{Op: op, Path: path, Err: err}
+}
+
+// addError добавляет ошибку поиска операции op над путем path
+func (d *Duplicates) addError(op, path string, err error) {
+	pathErr := d.pathError(op, path, err)
+
+	d.Lock()
+	d.errs = append(d.errs, pathErr)
+	d.Unlock()
+}
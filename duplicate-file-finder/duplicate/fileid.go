@@ -0,0 +1,35 @@
+package duplicate
+
+import "os"
+
+// FileID описывает устройство и inode файла
+type FileID struct {
+	Device uint64
+	Inode  uint64
+}
+
+// fileIdentity реализуется системной информацией о файле (os.FileInfo.Sys()) файловых систем,
+// которые сами сообщают устройство, inode и количество жестких ссылок, например мока файловой системы
+type fileIdentity interface {
+	FileID() FileID
+	Links() uint64
+}
+
+// fileID возвращает устройство и inode файла, если файловая система их сообщает
+func fileID(info os.FileInfo) (FileID, bool) {
+	if identity, ok := info.Sys().(fileIdentity); ok {
+		id := identity.FileID()
+		return id, id != FileID{}
+	}
+
+	return sysFileID(info.Sys())
+}
+
+// fileLinks возвращает количество жестких ссылок на файл, 0 - файловая система его не сообщает
+func fileLinks(info os.FileInfo) uint64 {
+	if identity, ok := info.Sys().(fileIdentity); ok {
+		return identity.Links()
+	}
+
+	return sysFileLinks(info.Sys())
+}
@@ -0,0 +1,14 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package duplicate
+
+// sysFileID устройство и inode файла на этой платформе недоступны
+func sysFileID(interface{}) (FileID, bool) {
+	return FileID{}, false
+}
+
+// sysFileLinks количество жестких ссылок на этой платформе недоступно
+func sysFileLinks(interface{}) uint64 {
+	return 0
+}
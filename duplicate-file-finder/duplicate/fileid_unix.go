@@ -0,0 +1,26 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package duplicate
+
+import "syscall"
+
+// sysFileID возвращает устройство и inode из системной информации о файле
+func sysFileID(sys interface{}) (FileID, bool) {
+	stat, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return FileID{}, false
+	}
+
+	return FileID{Device: uint64(stat.Dev), Inode: uint64(stat.Ino)}, true //nolint:unconvert // типы полей зависят от платформы
+}
+
+// sysFileLinks возвращает количество жестких ссылок из системной информации о файле
+func sysFileLinks(sys interface{}) uint64 {
+	stat, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+
+	return uint64(stat.Nlink) //nolint:unconvert // тип поля зависит от платформы
+}
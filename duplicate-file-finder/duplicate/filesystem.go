@@ -0,0 +1,115 @@
+package duplicate
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// FileContent описывает открытый для чтения файл
+type FileContent interface {
+	io.Reader
+	io.ReaderAt
+	io.Closer
+}
+
+// FSReader описывает чтение директории, информации о файле и содержимого файла
+type FSReader interface {
+	ReadDir(path string) ([]os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	Stat(name string) (os.FileInfo, error)
+	Readlink(name string) (string, error)
+	Open(name string) (FileContent, error)
+}
+
+// FSMutator описывает изменения файловой системы, которые выполняют действия над дубликатами
+type FSMutator interface {
+	Remove(name string) error
+	Rename(oldpath, newpath string) error
+	Link(oldname, newname string) error
+	Symlink(oldname, newname string) error
+	Reflink(src, dst string) error
+	MkdirAll(path string, perm os.FileMode) error
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// FSReadMutator описывает чтение и изменение файловой системы
+type FSReadMutator interface {
+	FSReader
+	FSMutator
+}
+
+// FileSystem представляет работу с файловой системой
+type FileSystem struct{}
+
+// ReadDir читает содержимое указанной директории
+func (dr FileSystem) ReadDir(dirPath string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dirPath)
+}
+
+// Lstat возвращает информацию о файле, не переходя по символической ссылке
+func (dr FileSystem) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// Stat возвращает информацию о файле, переходя по символическим ссылкам
+func (dr FileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Readlink возвращает содержимое символической ссылки
+func (dr FileSystem) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+// Open открывает файл для чтения содержимого
+func (dr FileSystem) Open(name string) (FileContent, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Remove удаляет файл по указанному пути
+func (dr FileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// Rename переименовывает файл, заменяя существующий файл newpath
+func (dr FileSystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// Link создает жесткую ссылку newname на файл oldname
+func (dr FileSystem) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+// Symlink создает символическую ссылку newname на oldname
+func (dr FileSystem) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+// Reflink создает файл dst, который разделяет блоки данных с файлом src (copy-on-write клон)
+func (dr FileSystem) Reflink(src, dst string) error {
+	return reflink(src, dst)
+}
+
+// MkdirAll создает директорию вместе со всеми родительскими директориями
+func (dr FileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// Create создает новый файл для записи. Существующий файл не перезаписывается
+func (dr FileSystem) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+}
+
+// Chtimes изменяет время доступа и изменения файла
+func (dr FileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
@@ -0,0 +1,263 @@
+package duplicate
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileNames файлы с правилами игнорирования, которые учитываются при Filter.IgnoreFiles
+var ignoreFileNames = []string{".gitignore", ".ignore"}
+
+// Filter описывает правила отбора файлов при сканировании.
+// Шаблоны Include и Exclude - glob-шаблоны, в которых ** соответствует любому количеству директорий.
+// Шаблон без разделителя директорий сравнивается с именем файла, иначе - с путем относительно стартовой директории.
+type Filter struct {
+	// Include если задан, учитываются только файлы, подходящие хотя бы под один шаблон
+	Include []string
+	// Exclude файлы и директории, подходящие под один из шаблонов, пропускаются
+	Exclude []string
+	// MinSize минимальный размер файла, 0 - без ограничения
+	MinSize int64
+	// MaxSize максимальный размер файла, 0 - без ограничения
+	MaxSize int64
+	// Extensions если задан, учитываются только файлы с этими расширениями
+	Extensions []string
+	// ExcludeExtensions файлы с этими расширениями пропускаются
+	ExcludeExtensions []string
+	// SkipHidden пропускать файлы и директории, имя которых начинается с точки
+	SkipHidden bool
+	// IgnoreFiles учитывать правила из файлов .gitignore и .ignore, найденных при обходе
+	IgnoreFiles bool
+}
+
+// Validate проверяет синтаксис шаблонов фильтра
+func (f Filter) Validate() error {
+	for _, patterns := range [][]string{f.Include, f.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("glob %q: %w", pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// skipDir проверяет, нужно ли пропустить директорию с путем relPath относительно стартовой директории
+func (f Filter) skipDir(relPath string, rules ignoreRules) bool {
+	if f.SkipHidden && isHidden(relPath) {
+		return true
+	}
+
+	return matchAnyGlob(f.Exclude, relPath) || rules.ignored(relPath, true)
+}
+
+// skipFile проверяет, нужно ли пропустить файл с путем relPath относительно стартовой директории
+func (f Filter) skipFile(relPath string, size int64, rules ignoreRules) bool {
+	switch {
+	case f.SkipHidden && isHidden(relPath):
+		return true
+	case f.MinSize > 0 && size < f.MinSize:
+		return true
+	case f.MaxSize > 0 && size > f.MaxSize:
+		return true
+	case len(f.Include) > 0 && !matchAnyGlob(f.Include, relPath):
+		return true
+	case matchAnyGlob(f.Exclude, relPath):
+		return true
+	}
+
+	ext := fileExtension(relPath)
+	if len(f.Extensions) > 0 && !containsExtension(f.Extensions, ext) {
+		return true
+	}
+	if containsExtension(f.ExcludeExtensions, ext) {
+		return true
+	}
+
+	return rules.ignored(relPath, false)
+}
+
+// isHidden проверяет, что имя файла начинается с точки
+func isHidden(relPath string) bool {
+	return strings.HasPrefix(path.Base(relPath), ".")
+}
+
+// fileExtension возвращает расширение файла без точки в нижнем регистре
+func fileExtension(relPath string) string {
+	return strings.ToLower(strings.TrimPrefix(path.Ext(relPath), "."))
+}
+
+// containsExtension проверяет, что расширение ext есть в списке. Расширения в списке можно указывать с точкой.
+func containsExtension(extensions []string, ext string) bool {
+	for _, e := range extensions {
+		if strings.ToLower(strings.TrimPrefix(e, ".")) == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchAnyGlob проверяет, что путь подходит хотя бы под один из шаблонов
+func matchAnyGlob(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "/") {
+			if matchGlob(pattern, relPath) {
+				return true
+			}
+			continue
+		}
+
+		if matched, _ := path.Match(pattern, path.Base(relPath)); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchGlob сравнивает путь с glob-шаблоном по сегментам. Сегмент ** соответствует любому количеству директорий.
+func matchGlob(pattern, relPath string) bool {
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(relPath, "/"))
+}
+
+// matchSegments сравнивает сегменты пути с сегментами шаблона
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+// ignoreRule описывает одно правило из файла .gitignore или .ignore
+type ignoreRule struct {
+	// base директория файла с правилом относительно стартовой директории
+	base    string
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules правила игнорирования, действующие в директории. Правила из вложенных директорий идут последними.
+type ignoreRules []ignoreRule
+
+// ignored проверяет, игнорируется ли путь relPath. Как и в git, решает последнее подходящее правило.
+func (r ignoreRules) ignored(relPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range r {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		if rule.match(relPath) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+// match сравнивает путь relPath с правилом
+func (r ignoreRule) match(relPath string) bool {
+	if r.base != "" {
+		if !strings.HasPrefix(relPath, r.base+"/") {
+			return false
+		}
+		relPath = relPath[len(r.base)+1:]
+	}
+
+	return matchGlob(r.pattern, relPath)
+}
+
+// parseIgnoreRules разбирает правила файла игнорирования из директории base
+func parseIgnoreRules(base string, content *bufio.Scanner) ignoreRules {
+	var rules ignoreRules
+	for content.Scan() {
+		line := strings.TrimRight(content.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		// Шаблон без разделителя в начале или середине действует на любом уровне вложенности
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if rule.pattern != "" {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// readIgnoreRules дополняет правила родительских директорий правилами из файлов игнорирования директории dirPath
+func (d *Duplicates) readIgnoreRules(dirPath, relDir string, list []os.FileInfo, rules ignoreRules) ignoreRules {
+	for _, name := range ignoreFileNames {
+		if !containsFile(list, name) {
+			continue
+		}
+
+		ignorePath := filepath.Join(dirPath, name)
+		content, err := d.fs.Open(ignorePath)
+		if err != nil {
+			d.addError(OpIgnore, ignorePath, err)
+			continue
+		}
+
+		// Копия нужна, чтобы правила соседних директорий не перезаписывали друг друга
+		rules = append(rules[:len(rules):len(rules)], parseIgnoreRules(relDir, bufio.NewScanner(content))...)
+		_ = content.Close()
+	}
+
+	return rules
+}
+
+// containsFile проверяет, что в списке есть обычный файл с именем name
+func containsFile(list []os.FileInfo, name string) bool {
+	for _, info := range list {
+		if info.Name() == name && !info.IsDir() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,459 @@
+package duplicate
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// ErrUnknownFormat Ошибка разбора неизвестного формата вывода
+var ErrUnknownFormat = errors.New("unknown output format")
+
+// Group описывает группу дубликатов. Первый файл группы остается, остальные считаются дубликатами.
+type Group struct {
+	Key   string
+	Files []File
+}
+
+// WastedBytes возвращает объем, который освободится после обработки дубликатов группы.
+// Жесткие ссылки на один файл учитываются один раз. Файл, часть жестких ссылок на который
+// не найдена при поиске, место не освобождает.
+func (g Group) WastedBytes() int64 {
+	var wasted int64
+	for _, links := range physicalFiles(g.Files[1:]) {
+		wasted += reclaimableBytes(links)
+	}
+
+	return wasted
+}
+
+// Report описывает результаты поиска для вывода
+type Report struct {
+	Match  MatchMode
+	Groups []Group
+	// HardLinks группы путей, которые являются жесткими ссылками на один файл
+	HardLinks []Group
+	// Dirs группы одинаковых директорий, найденные с WithDirs
+	Dirs []DirGroup
+	// Subsets директории-подмножества, найденные с WithDirs
+	Subsets []DirSubset
+	Summary Summary
+}
+
+// Report возвращает найденные группы дубликатов и жестких ссылок, упорядоченные по ключу, одинаковые директории
+// и директории-подмножества, если они искались, и сводку
+func (d *Duplicates) Report() Report {
+	groups := sortedGroups(d.files)
+
+	return Report{
+		Match:     d.match,
+		Groups:    groups,
+		HardLinks: sortedGroups(d.hardLinks),
+		Dirs:      d.dirGroups,
+		Subsets:   d.dirSubsets,
+		Summary:   d.newSummary(groups),
+	}
+}
+
+// sortedGroups возвращает группы файлов, упорядоченные по ключу
+func sortedGroups(files Files) []Group {
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	groups := make([]Group, 0, len(keys))
+	for _, key := range keys {
+		groups = append(groups, Group{Key: key, Files: files[key]})
+	}
+
+	return groups
+}
+
+// Formatter описывает формат вывода найденных дубликатов. Форматы table, json и jsonl выводят и сводку,
+// csv и fdupes - только файлы групп, чтобы сохранить фиксированную структуру строк: для них сводку можно
+// вывести отдельно через WriteSummary. Одинаковые директории и директории-подмножества выводят только
+// форматы table и json.
+type Formatter interface {
+	Format(out io.Writer, report Report) error
+}
+
+// formats форматы вывода по именам, используемым во флаге --format
+var formats = map[string]Formatter{
+	"table":  TableFormatter{},
+	"json":   JSONFormatter{},
+	"jsonl":  JSONLinesFormatter{},
+	"csv":    CSVFormatter{},
+	"fdupes": FdupesFormatter{},
+}
+
+// ParseFormat разбирает имя формата вывода: table, json, jsonl, csv, fdupes
+func ParseFormat(name string) (Formatter, error) {
+	if formatter, ok := formats[name]; ok {
+		return formatter, nil
+	}
+
+	return nil, fmt.Errorf("%q: %w", name, ErrUnknownFormat)
+}
+
+// WriteDuplicates выводит найденные дубликаты в формате formatter
+func (d *Duplicates) WriteDuplicates(out io.Writer, formatter Formatter) error {
+	return formatter.Format(out, d.Report())
+}
+
+// WriteSummary выводит сводку результатов поиска таблицей, как в конце формата table
+func (d *Duplicates) WriteSummary(out io.Writer) error {
+	return formatSummary(out, d.Report().Summary)
+}
+
+// HasSummary возвращает true, если формат formatter выводит сводку вместе с группами дубликатов
+func HasSummary(formatter Formatter) bool {
+	switch formatter.(type) {
+	case CSVFormatter, FdupesFormatter, ScriptFormatter:
+		return false
+	}
+
+	return true
+}
+
+// TableFormatter выводит дубликаты таблицей, оставляемый файл отмечается звездочкой
+type TableFormatter struct{}
+
+// Format выводит таблицы дубликатов, одинаковых директорий, директорий-подмножеств и жестких ссылок,
+// если они найдены, и сводку
+func (f TableFormatter) Format(out io.Writer, report Report) error {
+	if len(report.Groups) > 0 {
+		if err := f.formatGroups(out, report.Groups); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(out)
+	}
+
+	if len(report.Dirs) > 0 {
+		if err := f.formatDirs(out, report.Dirs); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(out)
+	}
+
+	if len(report.Subsets) > 0 {
+		if err := f.formatSubsets(out, report.Subsets); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(out)
+	}
+
+	if len(report.HardLinks) > 0 {
+		if err := f.formatHardLinks(out, report.HardLinks); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(out)
+	}
+
+	return formatSummary(out, report.Summary)
+}
+
+// formatHardLinks выводит таблицу жестких ссылок
+func (TableFormatter) formatHardLinks(out io.Writer, hardLinks []Group) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", "Hard Link", "File Name", "File Path", "File Size")
+
+	for _, group := range hardLinks {
+		for ind, file := range group.Files {
+			key := ""
+			if ind == 0 {
+				key = group.Key
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t\n", key, file.Name, file.Path, file.Size)
+		}
+	}
+
+	return w.Flush()
+}
+
+// formatDirs выводит таблицу одинаковых директорий, оставляемая директория отмечается звездочкой
+func (TableFormatter) formatDirs(out io.Writer, dirs []DirGroup) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", "Keep", "Identical Dir", "Files", "Size")
+
+	for _, group := range dirs {
+		for ind, dir := range group.Dirs {
+			keep := ""
+			if ind == 0 {
+				keep = "*"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t\n", keep, dir, group.Files, FormatBytes(group.Bytes))
+		}
+	}
+
+	return w.Flush()
+}
+
+// formatSubsets выводит таблицу директорий-подмножеств
+func (TableFormatter) formatSubsets(out io.Writer, subsets []DirSubset) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", "Subset Dir", "Superset Dir", "Files", "Size")
+
+	for _, subset := range subsets {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t\n", subset.Dir, subset.Superset, subset.Files, FormatBytes(subset.Bytes))
+	}
+
+	return w.Flush()
+}
+
+// formatGroups выводит таблицу групп дубликатов
+func (TableFormatter) formatGroups(out io.Writer, groups []Group) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", "Keep", "File Name", "File Path", "File Size")
+
+	for _, group := range groups {
+		for ind, file := range group.Files {
+			keep := ""
+			if ind == 0 {
+				keep = "*"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t\n", keep, file.Name, file.Path, file.Size)
+		}
+	}
+
+	return w.Flush()
+}
+
+// jsonFile описывает файл группы в JSON выводе
+type jsonFile struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Root    string    `json:"root,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"hash,omitempty"`
+	Kept    bool      `json:"kept"`
+}
+
+// jsonGroup описывает группу дубликатов в JSON выводе
+type jsonGroup struct {
+	Key         string     `json:"key"`
+	Match       string     `json:"match"`
+	WastedBytes int64      `json:"wastedBytes"`
+	Files       []jsonFile `json:"files"`
+}
+
+// jsonHardLinks описывает группу жестких ссылок на один файл в JSON выводе
+type jsonHardLinks struct {
+	Key   string   `json:"key"`
+	Size  int64    `json:"size"`
+	Paths []string `json:"paths"`
+}
+
+// jsonGroupSummary описывает группу дубликатов в сводке JSON вывода
+type jsonGroupSummary struct {
+	Key         string `json:"key"`
+	Files       int    `json:"files"`
+	WastedBytes int64  `json:"wastedBytes"`
+}
+
+// jsonDirSummary описывает директорию с дубликатами в сводке JSON вывода
+type jsonDirSummary struct {
+	Dir   string `json:"dir"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// jsonSummary описывает сводку в JSON выводе
+type jsonSummary struct {
+	Files            int64              `json:"files"`
+	Dirs             int64              `json:"dirs"`
+	Groups           int                `json:"groups"`
+	Duplicates       int                `json:"duplicates"`
+	ReclaimableBytes int64              `json:"reclaimableBytes"`
+	TopGroups        []jsonGroupSummary `json:"topGroups"`
+	TopDirs          []jsonDirSummary   `json:"topDirs"`
+}
+
+// jsonDirGroup описывает группу одинаковых директорий в JSON выводе, первая директория остается
+type jsonDirGroup struct {
+	Hash        string   `json:"hash"`
+	Files       int      `json:"files"`
+	Bytes       int64    `json:"bytes"`
+	WastedBytes int64    `json:"wastedBytes"`
+	Dirs        []string `json:"dirs"`
+}
+
+// jsonDirSubset описывает директорию-подмножество в JSON выводе
+type jsonDirSubset struct {
+	Dir      string `json:"dir"`
+	Superset string `json:"superset"`
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// jsonSummaryLine описывает последнюю строку JSON Lines вывода со сводкой
+type jsonSummaryLine struct {
+	Summary jsonSummary `json:"summary"`
+}
+
+// jsonReport описывает результаты поиска в JSON выводе
+type jsonReport struct {
+	Match     string          `json:"match"`
+	Groups    []jsonGroup     `json:"groups"`
+	HardLinks []jsonHardLinks `json:"hardLinks,omitempty"`
+	Dirs      []jsonDirGroup  `json:"dirs,omitempty"`
+	Subsets   []jsonDirSubset `json:"subsets,omitempty"`
+	Summary   jsonSummary     `json:"summary"`
+}
+
+// newJSONSummary преобразует сводку для JSON вывода
+func newJSONSummary(summary Summary) jsonSummary {
+	result := jsonSummary{
+		Files:            summary.Files,
+		Dirs:             summary.Dirs,
+		Groups:           summary.Groups,
+		Duplicates:       summary.Duplicates,
+		ReclaimableBytes: summary.ReclaimableBytes,
+		TopGroups:        make([]jsonGroupSummary, len(summary.TopGroups)),
+		TopDirs:          make([]jsonDirSummary, len(summary.TopDirs)),
+	}
+
+	for ind, group := range summary.TopGroups {
+		result.TopGroups[ind] = jsonGroupSummary{Key: group.Key, Files: group.Files, WastedBytes: group.WastedBytes}
+	}
+	for ind, dir := range summary.TopDirs {
+		result.TopDirs[ind] = jsonDirSummary{Dir: dir.Dir, Files: dir.Files, Bytes: dir.Bytes}
+	}
+
+	return result
+}
+
+// newJSONGroup преобразует группу дубликатов для JSON вывода
+func newJSONGroup(match MatchMode, group Group) jsonGroup {
+	files := make([]jsonFile, len(group.Files))
+	for ind, file := range group.Files {
+		files[ind] = jsonFile{
+			Name:    file.Name,
+			Path:    file.Path,
+			Root:    file.Root,
+			Size:    file.Size,
+			ModTime: file.ModTime,
+			Hash:    file.Hash,
+			Kept:    ind == 0,
+		}
+	}
+
+	return jsonGroup{Key: group.Key, Match: match.String(), WastedBytes: group.WastedBytes(), Files: files}
+}
+
+// JSONFormatter выводит все группы дубликатов одним JSON документом
+type JSONFormatter struct{}
+
+// Format выводит отчет одним JSON документом
+func (JSONFormatter) Format(out io.Writer, report Report) error {
+	result := jsonReport{
+		Match:   report.Match.String(),
+		Groups:  make([]jsonGroup, len(report.Groups)),
+		Summary: newJSONSummary(report.Summary),
+	}
+	for ind, group := range report.Groups {
+		result.Groups[ind] = newJSONGroup(report.Match, group)
+	}
+
+	for _, group := range report.HardLinks {
+		links := jsonHardLinks{Key: group.Key, Size: group.Files[0].Size, Paths: make([]string, len(group.Files))}
+		for ind, file := range group.Files {
+			links.Paths[ind] = file.Path
+		}
+		result.HardLinks = append(result.HardLinks, links)
+	}
+
+	for _, group := range report.Dirs {
+		result.Dirs = append(result.Dirs, jsonDirGroup{
+			Hash:        group.Hash,
+			Files:       group.Files,
+			Bytes:       group.Bytes,
+			WastedBytes: group.WastedBytes(),
+			Dirs:        group.Dirs,
+		})
+	}
+	for _, subset := range report.Subsets {
+		result.Subsets = append(result.Subsets, jsonDirSubset{
+			Dir:      subset.Dir,
+			Superset: subset.Superset,
+			Files:    subset.Files,
+			Bytes:    subset.Bytes,
+		})
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// JSONLinesFormatter выводит каждую группу дубликатов отдельной строкой JSON, последней строкой - сводку
+type JSONLinesFormatter struct{}
+
+// Format выводит по одному JSON объекту группы в строке и объект {"summary": ...} в последней строке
+func (JSONLinesFormatter) Format(out io.Writer, report Report) error {
+	encoder := json.NewEncoder(out)
+	for _, group := range report.Groups {
+		if err := encoder.Encode(newJSONGroup(report.Match, group)); err != nil {
+			return err
+		}
+	}
+
+	return encoder.Encode(jsonSummaryLine{Summary: newJSONSummary(report.Summary)})
+}
+
+// CSVFormatter выводит по одной строке CSV на каждый файл группы
+type CSVFormatter struct{}
+
+// Format выводит CSV с заголовком
+func (CSVFormatter) Format(out io.Writer, report Report) error {
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{"key", "match", "kept", "name", "path", "root", "size", "mtime", "wasted_bytes"})
+
+	for _, group := range report.Groups {
+		wasted := strconv.FormatInt(group.WastedBytes(), 10)
+		for ind, file := range group.Files {
+			_ = w.Write([]string{
+				group.Key,
+				report.Match.String(),
+				strconv.FormatBool(ind == 0),
+				file.Name,
+				file.Path,
+				file.Root,
+				strconv.FormatInt(file.Size, 10),
+				file.ModTime.Format(time.RFC3339Nano),
+				wasted,
+			})
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// FdupesFormatter выводит пути файлов в формате fdupes: по пути в строке, группы разделены пустой строкой
+type FdupesFormatter struct{}
+
+// Format выводит группы в формате fdupes, оставляемый файл идет первым в группе
+func (FdupesFormatter) Format(out io.Writer, report Report) error {
+	for _, group := range report.Groups {
+		for _, file := range group.Files {
+			if _, err := fmt.Fprintln(out, file.Path); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintln(out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package duplicate
+
+import (
+	"sort"
+	"strconv"
+)
+
+// hardLinkKey возвращает ключ группы жестких ссылок на файл id
+func hardLinkKey(id FileID) string {
+	return strconv.FormatUint(id.Device, 10) + ":" + strconv.FormatUint(id.Inode, 10)
+}
+
+// groupHardLinks группирует найденные пути, которые являются жесткими ссылками на один файл.
+// Файлы, для которых неизвестны устройство и inode, символические ссылки
+// и файлы с единственным найденным путем не учитываются.
+func groupHardLinks(scanned []File) Files {
+	links := make(Files)
+	for _, file := range scanned {
+		if file.ID == (FileID{}) || file.Symlink {
+			continue
+		}
+
+		key := hardLinkKey(file.ID)
+		links[key] = append(links[key], file)
+	}
+
+	for key, group := range links {
+		if len(group) < minGroupSize {
+			delete(links, key)
+			continue
+		}
+
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].Path < group[j].Path
+		})
+	}
+
+	return links
+}
+
+// physicalFiles разбивает группу на физические файлы: пути с одинаковыми устройством и inode
+// относятся к одному файлу. Порядок физических файлов соответствует порядку первых путей в группе.
+func physicalFiles(group []File) [][]File {
+	result := make([][]File, 0, len(group))
+	index := make(map[FileID]int, len(group))
+	for _, file := range group {
+		if file.ID == (FileID{}) {
+			result = append(result, []File{file})
+			continue
+		}
+
+		if ind, ok := index[file.ID]; ok {
+			result[ind] = append(result[ind], file)
+			continue
+		}
+
+		index[file.ID] = len(result)
+		result = append(result, []File{file})
+	}
+
+	return result
+}
+
+// withoutKeptLinks убирает из отсортированной группы жесткие ссылки на оставляемый файл:
+// это тот же физический файл, и действие над ними не освобождает место
+func withoutKeptLinks(group []File) []File {
+	kept := group[0]
+	if kept.ID == (FileID{}) {
+		return group
+	}
+
+	result := group[:1:1]
+	for _, file := range group[1:] {
+		if file.ID != kept.ID {
+			result = append(result, file)
+		}
+	}
+
+	return result
+}
+
+// reclaimableBytes возвращает объем, который освободится после удаления физического файла links.
+// Место освобождается, только если удаляются все жесткие ссылки на файл,
+// поэтому файл, часть ссылок на который не найдена при поиске, место не освобождает.
+// Удаление символических ссылок место не освобождает.
+func reclaimableBytes(links []File) int64 {
+	var regular uint64
+	for _, file := range links {
+		if !file.Symlink {
+			regular++
+		}
+	}
+
+	file := links[0]
+	switch {
+	case regular == 0:
+		return 0
+	case file.ID == (FileID{}):
+		return file.Size
+	case file.Links > regular:
+		return 0
+	}
+
+	return file.Size
+}
@@ -4,17 +4,23 @@ package duplicate
 
 import (
 	"bytes"
+	"errors"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 )
 
 type RealDuplicateFilesTestSuite struct {
 	suite.Suite
+	fs     FileSystem
+	logger *zap.Logger
 	finder *Duplicates
 }
 
@@ -28,6 +34,7 @@ func (s *RealDuplicateFilesTestSuite) SetupTest() {
 		{path: "./tmp/copy2.txt", content: "Some content for ./copy2.txt"},
 		{path: "./tmp/A/copy1.txt", content: "Some content for ./copy1.txt"},
 		{path: "./tmp/B/copy2.txt", content: "Some content for ./copy2.txt"},
+		{path: "./tmp/B/renamed.txt", content: "Some content for ./copy2.txt"},
 		{path: "./tmp/A/AA/copy1.txt", content: "Some content for ./copy1.txt"},
 		{path: "./tmp/A/AB/copy1.txt", content: "Some other content for ./copy1.txt"},
 	}
@@ -45,10 +52,15 @@ func (s *RealDuplicateFilesTestSuite) SetupTest() {
 
 		_, _ = file.WriteString(fileItem.content)
 		_ = file.Close()
+
+		err = os.Chtimes(fileItem.path, TestModTime, TestModTime)
+		if err != nil {
+			s.T().Fatal(err)
+		}
 	}
-	logger := zaptest.NewLogger(s.T())
-	fs := FileSystem{}
-	s.finder = NewDuplicateFinder(fs, logger)
+	s.logger = zaptest.NewLogger(s.T())
+	s.fs = FileSystem{}
+	s.finder = NewDuplicateFinder(s.fs, s.logger)
 }
 
 func (s *RealDuplicateFilesTestSuite) TearDownTest() {
@@ -65,8 +77,9 @@ func (s *RealDuplicateFilesTestSuite) TestDuplicatesSeek() {
 		}
 
 		s.T().Run(tt.Name, func(t *testing.T) {
-			dFiles := s.finder.Seek(tt.StartDir, tt.MaxDepth)
-			assert.Equal(t, tt.WantResult, dFiles)
+			s.finder = NewDuplicateFinder(s.fs, s.logger, WithMatch(tt.Match))
+			dFiles := s.finder.Seek(tt.StartDir, tt.MaxDepth).Files
+			assert.Equal(t, tt.WantResult, withoutFileIDs(dFiles))
 		})
 	}
 }
@@ -78,6 +91,7 @@ func (s *RealDuplicateFilesTestSuite) TestPrintDuplicates() {
 		}
 
 		s.T().Run(tt.Name, func(t *testing.T) {
+			s.finder = NewDuplicateFinder(s.fs, s.logger, WithMatch(tt.Match))
 			_ = s.finder.Seek(tt.StartDir, tt.MaxDepth)
 
 			out := new(bytes.Buffer)
@@ -95,6 +109,7 @@ func (s *RealDuplicateFilesTestSuite) TestRemoveAllDuplicates() {
 		}
 
 		s.T().Run(tt.Name, func(t *testing.T) {
+			s.finder = NewDuplicateFinder(s.fs, s.logger, WithMatch(tt.Match))
 			_ = s.finder.Seek(tt.StartDir, tt.MaxDepth)
 			s.finder.RemoveAllDuplicates()
 
@@ -109,6 +124,142 @@ func (s *RealDuplicateFilesTestSuite) TestRemoveAllDuplicates() {
 	}
 }
 
+func (s *RealDuplicateFilesTestSuite) TestHardlinkAllDuplicates() {
+	finder := NewDuplicateFinder(s.fs, s.logger, WithMatch(MatchContent))
+	dFiles := finder.Seek("./tmp", 0).Files
+
+	result := finder.ApplyAllDuplicates(HardlinkAction{})
+	s.Empty(result.Skipped)
+
+	for _, group := range dFiles {
+		kept, err := os.Stat(group[0].Path)
+		s.Require().NoError(err)
+
+		for _, file := range group[1:] {
+			linked, err := os.Stat(file.Path)
+			if s.NoError(err) {
+				s.True(os.SameFile(kept, linked), file.Path)
+			}
+		}
+	}
+
+	rescan := NewDuplicateFinder(s.fs, s.logger, WithMatch(MatchContent)).Seek("./tmp", 0)
+	s.Empty(rescan.Files)
+	s.Len(rescan.HardLinks, len(dFiles))
+	for _, group := range rescan.HardLinks {
+		s.Equal(uint64(len(group)), group[0].Links)
+	}
+}
+
+// withoutFileIDs убирает из найденных файлов устройство, inode и количество ссылок, которые зависят от файловой системы
+func withoutFileIDs(files Files) Files {
+	for _, group := range files {
+		for ind := range group {
+			group[ind].ID = FileID{}
+			group[ind].Links = 0
+		}
+	}
+
+	return files
+}
+
+func (s *RealDuplicateFilesTestSuite) TestSymlinkAllDuplicates() {
+	finder := NewDuplicateFinder(s.fs, s.logger)
+	_ = finder.Seek("./tmp", 0)
+
+	result := finder.ApplyAllDuplicates(SymlinkAction{Relative: true})
+	s.Len(result.Removed, 3)
+
+	target, err := os.Readlink("./tmp/A/AA/copy1.txt")
+	s.Require().NoError(err)
+	s.Equal("../../copy1.txt", target)
+	s.FileExists("./tmp/A/AA/copy1.txt")
+}
+
+func (s *RealDuplicateFilesTestSuite) TestFollowSymlinks() {
+	s.Require().NoError(os.Symlink("..", "./tmp/A/loop"))
+	s.Require().NoError(os.Symlink("../copy2.txt", "./tmp/B/link.txt"))
+
+	finder := NewDuplicateFinder(s.fs, s.logger, WithMatch(MatchContent), WithFollowSymlinks(true))
+	result := finder.Seek("./tmp", 0)
+	s.Empty(result.Errors)
+	s.Len(finder.scanned, 9)
+
+	for _, group := range result.Files {
+		s.False(group[0].Symlink)
+		for _, file := range group {
+			s.NotEqual("tmp/A/loop/copy1.txt", file.Path)
+		}
+	}
+
+	result = NewDuplicateFinder(s.fs, s.logger, WithMatch(MatchContent)).Seek("./tmp", 0)
+	s.Len(result.Files, 2)
+}
+
+func (s *RealDuplicateFilesTestSuite) TestReflink() {
+	err := s.fs.Reflink("./tmp/copy1.txt", "./tmp/clone.txt")
+	if err != nil {
+		s.True(errors.Is(err, ErrReflinkUnsupported), err.Error())
+		s.NoFileExists("./tmp/clone.txt")
+		return
+	}
+
+	content, err := ioutil.ReadFile("./tmp/clone.txt")
+	s.Require().NoError(err)
+	s.Equal("Some content for ./copy1.txt", string(content))
+}
+
+func (s *RealDuplicateFilesTestSuite) TestScriptWithUnusualNames() {
+	names := []string{"a.txt", "with space.txt", "it's.txt", "new\nline.txt", "bad\xff.txt", "-dash.txt"}
+	s.Require().NoError(os.MkdirAll("./tmp/odd", 0755))
+	for _, name := range names {
+		s.Require().NoError(ioutil.WriteFile(path.Join("./tmp/odd", name), []byte("odd content"), 0644))
+	}
+
+	finder := NewDuplicateFinder(s.fs, s.logger, WithMatch(MatchContent))
+	_ = finder.Seek("./tmp/odd", 0)
+
+	workDir, err := os.Getwd()
+	s.Require().NoError(err)
+	script := new(bytes.Buffer)
+	s.Require().NoError(finder.WriteDuplicates(script, ScriptFormatter{Action: RemoveAction{}, Dir: workDir}))
+
+	cmd := exec.Command("sh")
+	cmd.Stdin = script
+	cmd.Dir = os.TempDir()
+	output, err := cmd.CombinedOutput()
+	s.Require().NoError(err, string(output))
+
+	entries, err := ioutil.ReadDir("./tmp/odd")
+	s.Require().NoError(err)
+	s.Require().Len(entries, 1)
+	s.Equal("a.txt", entries[0].Name())
+}
+
+func (s *RealDuplicateFilesTestSuite) TestScriptContentChanged() {
+	s.Require().NoError(os.MkdirAll("./tmp/changed", 0755))
+	for _, name := range []string{"a.txt", "b.txt"} {
+		s.Require().NoError(ioutil.WriteFile(path.Join("./tmp/changed", name), []byte("same content"), 0644))
+	}
+
+	finder := NewDuplicateFinder(s.fs, s.logger, WithMatch(MatchContent))
+	_ = finder.Seek("./tmp/changed", 0)
+
+	script := new(bytes.Buffer)
+	s.Require().NoError(finder.WriteDuplicates(script, ScriptFormatter{Action: RemoveAction{}}))
+	s.Require().NoError(ioutil.WriteFile("./tmp/changed/b.txt", []byte("edited after search"), 0644))
+
+	cmd := exec.Command("sh")
+	cmd.Stdin = script
+	output, err := cmd.CombinedOutput()
+	s.Error(err)
+	s.Contains(string(output), "content differs: tmp/changed/b.txt")
+
+	entries, err := ioutil.ReadDir("./tmp/changed")
+	s.Require().NoError(err)
+	s.Len(entries, 2)
+}
+
 func TestRealDuplicateFilesTestSuite(t *testing.T) {
 	suite.Run(t, new(RealDuplicateFilesTestSuite))
 }
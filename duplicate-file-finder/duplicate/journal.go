@@ -0,0 +1,249 @@
+package duplicate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotReversible Ошибка, обозначающая что действие над дубликатом нельзя отменить
+var ErrNotReversible = errors.New("action is not reversible")
+
+// ErrJournalMismatch Ошибка, обозначающая что файл изменился после записи в журнал
+var ErrJournalMismatch = errors.New("file does not match journal entry")
+
+// JournalEntry описывает запись журнала о действии над одним дубликатом.
+// Target - путь, по которому после действия доступно содержимое дубликата.
+// Hash - SHA-256 содержимого оставленного файла, с которым совпадал дубликат.
+// Относительные пути отсчитываются от WorkDir, если он задан.
+type JournalEntry struct {
+	Group     string    `json:"group"`
+	Action    string    `json:"action"`
+	Kept      string    `json:"kept"`
+	Removed   string    `json:"removed"`
+	Target    string    `json:"target,omitempty"`
+	WorkDir   string    `json:"workDir,omitempty"`
+	Trash     string    `json:"trash,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mtime"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// path возвращает путь относительно рабочей директории, в которой запись была создана
+func (e JournalEntry) path(name string) string {
+	if e.WorkDir == "" || filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(e.WorkDir, name)
+}
+
+// Journal дописывает записи о выполненных действиях над дубликатами в формате JSON Lines.
+// WorkDir записывается в каждую запись, чтобы отменить действия из любой рабочей директории.
+type Journal struct {
+	WorkDir string
+	writer  jsonLinesWriter
+}
+
+// NewJournal создает журнал, записываемый в w
+func NewJournal(w io.Writer, workDir string) *Journal {
+	return &Journal{WorkDir: workDir, writer: newJSONLinesWriter(w)}
+}
+
+// Record дописывает в журнал запись о действии action над дубликатом file файла kept.
+// Хэш оставленного файла kept должен быть посчитан: по нему проверяется содержимое при отмене действия.
+// Для карантина в запись попадает его директория, чтобы при отмене обновить манифест карантина.
+func (j *Journal) Record(group string, action Action, kept, file File, target string) error {
+	entry := JournalEntry{
+		Group:     group,
+		Action:    action.String(),
+		Kept:      kept.Path,
+		Removed:   file.Path,
+		Target:    target,
+		WorkDir:   j.WorkDir,
+		Hash:      kept.Hash,
+		Size:      file.Size,
+		ModTime:   file.ModTime,
+		Timestamp: time.Now().UTC(),
+	}
+	if quarantine, ok := action.(QuarantineAction); ok {
+		entry.Trash = quarantine.Dir
+	}
+
+	return j.writer.write(entry)
+}
+
+// ReadJournal читает все записи журнала
+func ReadJournal(r io.Reader) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	err := readJSONLines(r, func(line []byte) error {
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+
+	return entries, nil
+}
+
+// UndoFailure описывает запись журнала, которую не удалось отменить
+type UndoFailure struct {
+	Entry  JournalEntry
+	Reason error
+}
+
+// UndoResult описывает результат отмены действий из журнала
+type UndoResult struct {
+	Undone []JournalEntry
+	Failed []UndoFailure
+}
+
+// Undo отменяет действия из журнала в обратном порядке. Файлы из карантина возвращаются на место,
+// ссылки и клоны заменяются независимыми копиями оставленного файла, если содержимое ссылки или клона
+// и оставленного файла совпадает с хэшем из журнала. Удаление отменить нельзя.
+func Undo(fs FSReadMutator, entries []JournalEntry) *UndoResult {
+	result := &UndoResult{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if err := undoEntry(fs, entry); err != nil {
+			result.Failed = append(result.Failed, UndoFailure{Entry: entry, Reason: err})
+			continue
+		}
+
+		result.Undone = append(result.Undone, entry)
+	}
+
+	return result
+}
+
+// undoEntry отменяет одно действие из журнала
+func undoEntry(fs FSReadMutator, entry JournalEntry) error {
+	removed := entry.path(entry.Removed)
+
+	switch entry.Action {
+	case RemoveAction{}.String():
+		return fmt.Errorf("%s %s: %w", entry.Action, removed, ErrNotReversible)
+	case QuarantineAction{}.String():
+		return restoreFile(fs, entry.path(entry.Target), removed)
+	case SymlinkAction{}.String():
+		target, err := fs.Readlink(removed)
+		if err != nil {
+			return err
+		}
+
+		if target != entry.Target {
+			return fmt.Errorf("%s points to %s: %w", removed, target, ErrJournalMismatch)
+		}
+	case HardlinkAction{}.String(), ReflinkAction{}.String():
+		info, err := fs.Lstat(removed)
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() || info.Size() != entry.Size {
+			return fmt.Errorf("%s: %w", removed, ErrJournalMismatch)
+		}
+
+		hash, err := contentHash(fs, removed)
+		if err != nil {
+			return err
+		}
+		if entry.Hash == "" || hash != entry.Hash {
+			return fmt.Errorf("%s: hash %s, want %q: %w", removed, hash, entry.Hash, ErrJournalMismatch)
+		}
+	default:
+		return fmt.Errorf("%q: %w", entry.Action, ErrUnknownAction)
+	}
+
+	return materialize(fs, entry)
+}
+
+// materialize заменяет ссылку или клон на месте дубликата независимой копией оставленного файла
+// и восстанавливает время изменения дубликата
+func materialize(fs FSReadMutator, entry JournalEntry) error {
+	kept := entry.path(entry.Kept)
+	removed := entry.path(entry.Removed)
+
+	info, err := fs.Lstat(kept)
+	if err != nil {
+		return err
+	}
+
+	return replace(fs, File{Path: removed}, func(tmpPath string) error {
+		hash, err := copyFile(fs, kept, tmpPath, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		if hash != entry.Hash {
+			_ = fs.Remove(tmpPath)
+			return fmt.Errorf("%s: %w", kept, ErrJournalMismatch)
+		}
+
+		if err = fs.Chtimes(tmpPath, entry.ModTime, entry.ModTime); err != nil {
+			_ = fs.Remove(tmpPath)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// contentHash возвращает SHA-256 содержимого файла name
+func contentHash(fs FSReader, name string) (string, error) {
+	content, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, content); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// copyFile копирует содержимое src в новый файл dst и возвращает SHA-256 скопированного содержимого
+func copyFile(fs FSReadMutator, src, dst string, perm os.FileMode) (string, error) {
+	content, err := fs.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	out, err := fs.Create(dst, perm)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), content)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = fs.Remove(dst)
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
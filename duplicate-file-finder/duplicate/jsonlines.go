@@ -0,0 +1,45 @@
+package duplicate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// jsonLinesWriter потокобезопасно дописывает значения в формате JSON Lines
+type jsonLinesWriter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// newJSONLinesWriter создает запись JSON Lines в w
+func newJSONLinesWriter(w io.Writer) jsonLinesWriter {
+	return jsonLinesWriter{encoder: json.NewEncoder(w)}
+}
+
+// write дописывает значение отдельной строкой
+func (w *jsonLinesWriter) write(v interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.encoder.Encode(v)
+}
+
+// readJSONLines читает JSON Lines из r и разбирает каждую непустую строку функцией decode
+func readJSONLines(r io.Reader, decode func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		if err := decode(scanner.Bytes()); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	return scanner.Err()
+}
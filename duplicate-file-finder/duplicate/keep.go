@@ -0,0 +1,306 @@
+package duplicate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrUnknownKeepPolicy Ошибка разбора неизвестного правила выбора оставляемого файла
+var ErrUnknownKeepPolicy = errors.New("unknown keep policy")
+
+// KeepPolicy описывает правило выбора файла, который остается в группе дубликатов
+type KeepPolicy interface {
+	// Compare возвращает отрицательное число, если оставить предпочтительнее файл a,
+	// положительное, если файл b, и 0, если правило их не различает
+	Compare(a, b File) int
+	// String возвращает правило в формате флага --keep
+	String() string
+}
+
+// defaultKeepPolicy правило по умолчанию: оставляется файл с самым коротким путем
+var defaultKeepPolicy = KeepPolicies{KeepShortestPath{}}
+
+// tieBreakPolicy правило, которое однозначно упорядочивает файлы, не различимые выбранными правилами
+var tieBreakPolicy = KeepPolicies{KeepShortestPath{}, KeepLexical{}}
+
+// ParseKeepPolicy разбирает правило выбора оставляемого файла:
+// shortest, oldest, newest, lexical, glob:ШАБЛОН, regex:ВЫРАЖЕНИЕ, dir:ДИРЕКТОРИЯ, root:СТАРТОВАЯ_ДИРЕКТОРИЯ
+func ParseKeepPolicy(spec string) (KeepPolicy, error) {
+	name, arg := spec, ""
+	if ind := strings.Index(spec, ":"); ind >= 0 {
+		name, arg = spec[:ind], spec[ind+1:]
+	}
+
+	switch name {
+	case "shortest":
+		return KeepShortestPath{}, nil
+	case "oldest":
+		return KeepOldest{}, nil
+	case "newest":
+		return KeepNewest{}, nil
+	case "lexical":
+		return KeepLexical{}, nil
+	case "glob":
+		return NewKeepGlob(arg)
+	case "regex":
+		return NewKeepRegexp(arg)
+	case "dir":
+		return NewKeepInDir(arg)
+	case "root":
+		return NewKeepInRoot(arg)
+	}
+
+	return nil, fmt.Errorf("%q: %w", spec, ErrUnknownKeepPolicy)
+}
+
+// KeepPolicies применяет правила по очереди: следующее правило учитывается, только если предыдущие не различили файлы
+type KeepPolicies []KeepPolicy
+
+// Compare сравнивает файлы первым различающим их правилом
+func (p KeepPolicies) Compare(a, b File) int {
+	for _, policy := range p {
+		if result := policy.Compare(a, b); result != 0 {
+			return result
+		}
+	}
+
+	return 0
+}
+
+func (p KeepPolicies) String() string {
+	specs := make([]string, len(p))
+	for i, policy := range p {
+		specs[i] = policy.String()
+	}
+
+	return strings.Join(specs, ",")
+}
+
+// KeepShortestPath оставляет файл с самым коротким путем
+type KeepShortestPath struct{}
+
+// Compare сравнивает длины путей файлов
+func (KeepShortestPath) Compare(a, b File) int {
+	return len(a.Path) - len(b.Path)
+}
+
+func (KeepShortestPath) String() string {
+	return "shortest"
+}
+
+// KeepOldest оставляет файл с самым ранним временем изменения
+type KeepOldest struct{}
+
+// Compare сравнивает время изменения файлов
+func (KeepOldest) Compare(a, b File) int {
+	return compareTime(a, b)
+}
+
+func (KeepOldest) String() string {
+	return "oldest"
+}
+
+// KeepNewest оставляет файл с самым поздним временем изменения
+type KeepNewest struct{}
+
+// Compare сравнивает время изменения файлов
+func (KeepNewest) Compare(a, b File) int {
+	return -compareTime(a, b)
+}
+
+func (KeepNewest) String() string {
+	return "newest"
+}
+
+// compareTime сравнивает время изменения файлов
+func compareTime(a, b File) int {
+	switch {
+	case a.ModTime.Before(b.ModTime):
+		return -1
+	case a.ModTime.After(b.ModTime):
+		return 1
+	}
+
+	return 0
+}
+
+// KeepLexical оставляет файл, путь которого идет первым в лексикографическом порядке
+type KeepLexical struct{}
+
+// Compare сравнивает пути файлов лексикографически
+func (KeepLexical) Compare(a, b File) int {
+	return strings.Compare(a.Path, b.Path)
+}
+
+func (KeepLexical) String() string {
+	return "lexical"
+}
+
+// KeepMatching оставляет файл, путь которого подходит под шаблон
+type KeepMatching struct {
+	spec  string
+	match func(path string) bool
+}
+
+// NewKeepGlob создает правило, по которому оставляется файл, подходящий под glob-шаблон.
+// Шаблон без разделителя директорий сравнивается с именем файла, иначе - со всем путем.
+func NewKeepGlob(pattern string) (KeepMatching, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return KeepMatching{}, fmt.Errorf("glob %q: %w", pattern, err)
+	}
+
+	byName := !strings.ContainsRune(pattern, filepath.Separator) && !strings.ContainsRune(pattern, '/')
+	return KeepMatching{
+		spec: "glob:" + pattern,
+		match: func(path string) bool {
+			if byName {
+				path = filepath.Base(path)
+			}
+
+			matched, _ := filepath.Match(pattern, filepath.ToSlash(path))
+			return matched
+		},
+	}, nil
+}
+
+// NewKeepRegexp создает правило, по которому оставляется файл, путь которого подходит под регулярное выражение
+func NewKeepRegexp(expr string) (KeepMatching, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return KeepMatching{}, fmt.Errorf("regex %q: %w", expr, err)
+	}
+
+	return KeepMatching{spec: "regex:" + expr, match: re.MatchString}, nil
+}
+
+// Compare предпочитает файл, подходящий под шаблон
+func (p KeepMatching) Compare(a, b File) int {
+	return compareBool(p.match(a.Path), p.match(b.Path))
+}
+
+func (p KeepMatching) String() string {
+	return p.spec
+}
+
+// KeepInDir оставляет файл, находящийся внутри директории Dir. Правило создается NewKeepInDir.
+type KeepInDir struct {
+	Dir string
+	// abs абсолютный путь Dir
+	abs string
+	// workDir рабочая директория, от которой отсчитываются относительные пути файлов
+	workDir string
+}
+
+// NewKeepInDir создает правило, по которому оставляется файл внутри директории dir.
+// Пути приводятся к абсолютным от текущей рабочей директории один раз, при создании правила.
+func NewKeepInDir(dir string) (KeepInDir, error) {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return KeepInDir{}, err
+	}
+
+	return KeepInDir{Dir: dir, abs: absPath(workDir, dir), workDir: workDir}, nil
+}
+
+// Compare предпочитает файл из директории Dir
+func (p KeepInDir) Compare(a, b File) int {
+	return compareBool(insideDir(p.abs, absPath(p.workDir, a.Path)), insideDir(p.abs, absPath(p.workDir, b.Path)))
+}
+
+func (p KeepInDir) String() string {
+	return "dir:" + p.Dir
+}
+
+// KeepInRoot оставляет файл, найденный в стартовой директории Root. Правило создается NewKeepInRoot.
+// В отличие от KeepInDir, учитывается стартовая директория, от которой найден файл,
+// поэтому файлы вложенных стартовых директорий к Root не относятся.
+type KeepInRoot struct {
+	Root string
+	// abs абсолютный путь Root
+	abs string
+	// workDir рабочая директория, от которой отсчитываются относительные стартовые директории файлов
+	workDir string
+}
+
+// NewKeepInRoot создает правило, по которому оставляется файл, найденный в стартовой директории root.
+// Пути приводятся к абсолютным от текущей рабочей директории один раз, при создании правила.
+func NewKeepInRoot(root string) (KeepInRoot, error) {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return KeepInRoot{}, err
+	}
+
+	return KeepInRoot{Root: root, abs: absPath(workDir, root), workDir: workDir}, nil
+}
+
+// Compare предпочитает файл из стартовой директории Root
+func (p KeepInRoot) Compare(a, b File) int {
+	return compareBool(p.contains(a), p.contains(b))
+}
+
+// contains проверяет, что файл найден в стартовой директории Root
+func (p KeepInRoot) contains(file File) bool {
+	return file.Root != "" && absPath(p.workDir, file.Root) == p.abs
+}
+
+func (p KeepInRoot) String() string {
+	return "root:" + p.Root
+}
+
+// absPath возвращает абсолютный путь name без обращения к файловой системе:
+// относительный путь отсчитывается от рабочей директории workDir
+func absPath(workDir, name string) string {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+
+	return filepath.Join(workDir, name)
+}
+
+// insideDir проверяет, что абсолютный путь filePath совпадает с абсолютным путем директории dir или находится внутри нее
+func insideDir(dir, filePath string) bool {
+	rel, err := filepath.Rel(dir, filePath)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// compareBool предпочитает сторону, для которой условие выполняется
+func compareBool(a, b bool) int {
+	switch {
+	case a && !b:
+		return -1
+	case !a && b:
+		return 1
+	}
+
+	return 0
+}
+
+// byKeepPolicy сортирует файлы группы так, что оставляемый файл оказывается первым
+type byKeepPolicy struct {
+	files  []File
+	policy KeepPolicy
+}
+
+func (f byKeepPolicy) Len() int {
+	return len(f.files)
+}
+
+func (f byKeepPolicy) Swap(i, j int) {
+	f.files[i], f.files[j] = f.files[j], f.files[i]
+}
+
+func (f byKeepPolicy) Less(i, j int) bool {
+	if result := f.policy.Compare(f.files[i], f.files[j]); result != 0 {
+		return result < 0
+	}
+
+	return tieBreakPolicy.Compare(f.files[i], f.files[j]) < 0
+}
@@ -1,54 +1,40 @@
-// Package duplicate ищет и удаляет дубликаты файлов(одинаковые имя и размер файлов)
+// Package duplicate ищет и удаляет дубликаты файлов(одинаковые имя и размер файлов или одинаковое содержимое)
 package duplicate
 
 import (
-	"fmt"
+	"context"
 	"io"
-	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"sync"
-	"text/tabwriter"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 )
 
-// FSReader описывает чтение директории
-type FSReader interface {
-	ReadDir(path string) ([]os.FileInfo, error)
-}
-
-// FSDeleter описывает удаление файла
-type FSDeleter interface {
-	Remove(name string) error
-}
-
-// FSReadDeleter описывает чтение директории и удаление файла
-type FSReadDeleter interface {
-	FSReader
-	FSDeleter
-}
-
-// FileSystem представляет работу с файловой системой
-type FileSystem struct{}
-
-// ReadDir читает содержимое указанной директории
-func (dr FileSystem) ReadDir(dirPath string) ([]os.FileInfo, error) {
-	return ioutil.ReadDir(dirPath)
-}
-
-// Remove удаляет файл по указанному пути
-func (dr FileSystem) Remove(name string) error {
-	return os.Remove(name)
-}
-
 // File описывает единичный файл в поиске
 type File struct {
 	Name string
 	Path string
 	Size int64
+	// ModTime время изменения файла в UTC
+	ModTime time.Time
+	// Hash SHA-256 содержимого, заполняется только при сравнении по содержимому
+	Hash string
+	// Root стартовая директория, в которой найден файл
+	Root string
+	// ID устройство и inode файла, нулевое значение - файловая система их не сообщает.
+	// Пути с одинаковым ID являются жесткими ссылками на один физический файл.
+	ID FileID
+	// Links количество жестких ссылок на файл, 0 - файловая система его не сообщает
+	Links uint64
+	// Symlink файл найден по символической ссылке: Path - путь ссылки, остальные поля описывают файл,
+	// на который она указывает. Такой файл не бывает оставляемым и не считается дубликатом файла, на который указывает.
+	Symlink bool
 }
 
 // Files описывает все найденные файлы, сгруппированные по копиям
@@ -56,146 +42,428 @@ type Files map[string][]File
 
 // Duplicates управляет поиском дубликатов
 type Duplicates struct {
-	fs FSReadDeleter
+	fs FSReadMutator
 	sync.Mutex
-	files Files
+	scanned []File
+	files   Files
+	// hardLinks найденные пути, которые являются жесткими ссылками на один файл
+	hardLinks Files
 	sync.WaitGroup
-	logger *zap.Logger
+	logger  *zap.Logger
+	match   MatchMode
+	verify  bool
+	journal *Journal
+	keep    KeepPolicy
+	filter  Filter
+	stats   PipelineStats
+	errs    PathErrors
+	cache   *HashCache
+	// followSymlinks переходить по символическим ссылкам при сканировании
+	followSymlinks bool
+	// visited прочитанные директории при переходе по символическим ссылкам
+	visited map[FileID]bool
+	// nestedRoots абсолютные пути стартовых директорий, вложенных в другие стартовые директории
+	nestedRoots map[string]bool
+	// progress счетчики хода работы для progressFunc
+	progress         progressCounters
+	progressFunc     ProgressFunc
+	progressInterval time.Duration
+	// summaryTop количество групп и директорий в топах сводки
+	summaryTop int
+	// jobs количество одновременно читаемых директорий
+	jobs int
+	// hashJobs количество одновременно хэшируемых файлов
+	hashJobs int
+	// dirs искать одинаковые директории
+	dirs bool
+	// dirNodes директории найденных файлов по пути
+	dirNodes map[string]*dirNode
+	// dirsByHash директории без уникальных файлов по хэшу содержимого
+	dirsByHash map[string][]*dirNode
+	dirGroups  []DirGroup
+	dirSubsets []DirSubset
+}
+
+// Option настраивает поиск дубликатов
+type Option func(d *Duplicates)
+
+// WithMatch задает способ сравнения файлов
+func WithMatch(match MatchMode) Option {
+	return func(d *Duplicates) {
+		d.match = match
+	}
+}
+
+// WithVerify включает побайтовое сравнение каждого дубликата с оставляемым файлом перед удалением
+func WithVerify(verify bool) Option {
+	return func(d *Duplicates) {
+		d.verify = verify
+	}
+}
+
+// WithJournal включает запись каждого выполненного действия над дубликатами в журнал
+func WithJournal(journal *Journal) Option {
+	return func(d *Duplicates) {
+		d.journal = journal
+	}
+}
+
+// WithKeepPolicy задает правила выбора оставляемого файла в группе дубликатов.
+// Правила применяются по очереди, неразличимые ими файлы упорядочиваются по длине пути и лексикографически.
+func WithKeepPolicy(policies ...KeepPolicy) Option {
+	return func(d *Duplicates) {
+		if len(policies) > 0 {
+			d.keep = KeepPolicies(policies)
+		}
+	}
+}
+
+// WithFilter задает правила отбора файлов при сканировании
+func WithFilter(filter Filter) Option {
+	return func(d *Duplicates) {
+		d.filter = filter
+	}
+}
+
+// WithJobs ограничивает количество одновременно читаемых директорий. n <= 0 - GOMAXPROCS
+func WithJobs(n int) Option {
+	return func(d *Duplicates) {
+		if n > 0 {
+			d.jobs = n
+		}
+	}
+}
+
+// WithHashJobs ограничивает количество одновременно хэшируемых файлов. n <= 0 - GOMAXPROCS
+func WithHashJobs(n int) Option {
+	return func(d *Duplicates) {
+		if n > 0 {
+			d.hashJobs = n
+		}
+	}
 }
 
 // NewDuplicateFinder инициализирует поиск
-func NewDuplicateFinder(fs FSReadDeleter, logger *zap.Logger) *Duplicates {
-	return &Duplicates{
-		fs:     fs,
-		files:  make(Files),
-		logger: logger,
+func NewDuplicateFinder(fs FSReadMutator, logger *zap.Logger, opts ...Option) *Duplicates {
+	d := &Duplicates{
+		fs:         fs,
+		files:      make(Files),
+		logger:     logger,
+		keep:       defaultKeepPolicy,
+		summaryTop: DefaultSummaryTop,
+		jobs:       runtime.GOMAXPROCS(0),
+		hashJobs:   runtime.GOMAXPROCS(0),
+	}
+
+	for _, opt := range opts {
+		opt(d)
 	}
+
+	return d
 }
 
-// Seek ищет дубликаты файлов
-func (d *Duplicates) Seek(startPath string, maxDepth int) Files {
-	d.Add(1)
-	go d.scanDir(path.Clean(startPath), maxDepth, 1)
+// SeekResult описывает результат поиска дубликатов
+type SeekResult struct {
+	Files Files
+	// Incomplete поиск был прерван, найдены дубликаты только среди уже прочитанных файлов
+	Incomplete bool
+	// Errors ошибки чтения директорий и файлов. Пути с ошибками не участвуют в поиске.
+	Errors PathErrors
+	// HardLinks группы найденных путей, которые являются жесткими ссылками на один файл, по ключу "устройство:inode".
+	// Жесткие ссылки на оставляемый файл не считаются его дубликатами и в Files не попадают.
+	HardLinks Files
+	// Dirs группы одинаковых директорий, найденные с WithDirs
+	Dirs []DirGroup
+	// Subsets директории, каждый файл которых есть в большей директории, найденные с WithDirs
+	Subsets []DirSubset
+}
 
-	d.Wait()
+// Seek ищет дубликаты файлов
+func (d *Duplicates) Seek(startPath string, maxDepth int) *SeekResult {
+	return d.SeekContext(context.Background(), startPath, maxDepth)
+}
 
-	d.filterFiles()
+// SeekContext ищет дубликаты файлов, пока не отменен контекст ctx.
+// После отмены обход директорий и хэширование останавливаются, а результат помечается как неполный.
+func (d *Duplicates) SeekContext(ctx context.Context, startPath string, maxDepth int) *SeekResult {
+	return d.SeekRootsContext(ctx, []string{startPath}, maxDepth)
+}
 
-	return d.files
+// SeekRoots ищет дубликаты файлов среди нескольких стартовых директорий
+func (d *Duplicates) SeekRoots(roots []string, maxDepth int) *SeekResult {
+	return d.SeekRootsContext(context.Background(), roots, maxDepth)
 }
 
-// scanDir рекурсивно сканирует директории в поисках дубликатов
-func (d *Duplicates) scanDir(dirPath string, maxDepth, level int) {
-	defer d.Done()
+// SeekRootsContext ищет дубликаты файлов среди нескольких стартовых директорий, пока не отменен контекст ctx.
+// Повторяющиеся стартовые директории обходятся один раз. Если стартовая директория находится внутри другой,
+// ее файлы учитываются один раз и относятся к вложенной директории. maxDepth отсчитывается от каждой стартовой директории.
+func (d *Duplicates) SeekRootsContext(ctx context.Context, roots []string, maxDepth int) *SeekResult {
+	seekRoots := d.enterRoots(newSeekRoots(roots))
+	d.nestedRoots = nestedRoots(seekRoots)
+	d.scanned = nil
+	d.errs = nil
+	d.stats = PipelineStats{}
+	d.progress = progressCounters{}
+
+	stopProgress := d.startProgress()
+	defer stopProgress()
+
+	d.walk(ctx, seekRoots, maxDepth)
+
+	if d.match == MatchContent {
+		d.progress.setStage(ProgressHash)
+	}
+	d.groupFiles(ctx)
+	if d.dirs {
+		d.findDirs()
+	}
+	d.filterFiles()
+	d.hardLinks = groupHardLinks(d.scanned)
+	d.progress.setGroups(d.files)
+
+	return &SeekResult{
+		Files:      d.files,
+		Incomplete: ctx.Err() != nil,
+		Errors:     d.errs,
+		HardLinks:  d.hardLinks,
+		Dirs:       d.dirGroups,
+		Subsets:    d.dirSubsets,
+	}
+}
 
-	d.logger.Info("Start scanning dir " + dirPath)
-	list, err := d.fs.ReadDir(dirPath)
+// scanDir читает директорию task, добавляет найденные файлы в поиск
+// и возвращает поддиректории, которые нужно прочитать дальше
+func (d *Duplicates) scanDir(task dirTask, maxDepth int) []dirTask {
+	d.logger.Info("Start scanning dir " + task.path)
+	list, err := d.fs.ReadDir(task.path)
 	if err != nil {
-		d.logger.Error("Can't read dir " + dirPath)
-		_, _ = fmt.Fprintln(os.Stderr, err)
-		return
+		d.addError(OpReadDir, task.path, err)
+		return nil
 	}
+	atomic.AddInt64(&d.progress.dirs, 1)
 
-	for _, val := range list {
-		currPath := filepath.Join(dirPath, val.Name())
+	rules := task.rules
+	if d.filter.IgnoreFiles {
+		rules = d.readIgnoreRules(task.path, task.relPath, list, rules)
+	}
+
+	var children []dirTask
+	for _, entry := range list {
+		currPath := filepath.Join(task.path, entry.Name())
+		relPath := path.Join(task.relPath, entry.Name())
+
+		val, ok := d.resolveEntry(currPath, entry)
+		if !ok {
+			continue
+		}
 
 		if val.IsDir() {
-			if maxDepth <= 0 || level < maxDepth {
-				d.Add(1)
-				go d.scanDir(currPath, maxDepth, level+1)
+			if d.filter.skipDir(relPath, rules) || d.isNestedRoot(task, relPath) {
+				continue
+			}
+
+			if (maxDepth <= 0 || task.level < maxDepth) && d.enterDir(val) {
+				children = append(children, dirTask{
+					root:    task.root,
+					path:    currPath,
+					relPath: relPath,
+					level:   task.level + 1,
+					rules:   rules,
+				})
 			}
 			continue
 		}
 
-		fileToken := fmt.Sprintf("%s_%d", val.Name(), val.Size())
+		if d.filter.skipFile(relPath, val.Size(), rules) {
+			continue
+		}
+
+		id, _ := fileID(val)
 		d.Lock()
-		d.files[fileToken] = append(d.files[fileToken], File{
-			Name: val.Name(),
-			Path: currPath,
-			Size: val.Size(),
+		d.scanned = append(d.scanned, File{
+			Name:    val.Name(),
+			Path:    currPath,
+			Size:    val.Size(),
+			ModTime: val.ModTime().UTC(),
+			Root:    task.root.path,
+			ID:      id,
+			Links:   fileLinks(val),
+			Symlink: entry.Mode()&os.ModeSymlink != 0,
 		})
 		d.Unlock()
+		atomic.AddInt64(&d.progress.files, 1)
 	}
+
+	return children
+}
+
+// SkippedFile описывает дубликат, который не был удален
+type SkippedFile struct {
+	File   File
+	Kept   File
+	Reason error
+}
+
+// RemoveResult описывает результат удаления дубликатов.
+// Removed содержит дубликаты, которые были удалены или заменены ссылкой на оставляемый файл.
+type RemoveResult struct {
+	Removed []File
+	Skipped []SkippedFile
+	// Incomplete обработка была прервана, часть дубликатов не обработана
+	Incomplete bool
+	// Errors ошибки выполнения действия и записи журнала
+	Errors PathErrors
 }
 
 // RemoveAllDuplicates удаляет все дубликаты файлов
-func (d *Duplicates) RemoveAllDuplicates() {
-	for fileSetKey := range d.files {
+func (d *Duplicates) RemoveAllDuplicates() *RemoveResult {
+	return d.ApplyAllDuplicates(RemoveAction{})
+}
+
+// RemoveAllDuplicatesContext удаляет дубликаты файлов, пока не отменен контекст ctx
+func (d *Duplicates) RemoveAllDuplicatesContext(ctx context.Context) *RemoveResult {
+	return d.ApplyAllDuplicatesContext(ctx, RemoveAction{})
+}
+
+// ApplyAllDuplicates обрабатывает все дубликаты файлов выбранным действием
+func (d *Duplicates) ApplyAllDuplicates(action Action) *RemoveResult {
+	return d.ApplyAllDuplicatesContext(context.Background(), action)
+}
+
+// ApplyAllDuplicatesContext обрабатывает дубликаты файлов выбранным действием, пока не отменен контекст ctx.
+// Действие над отдельным файлом не прерывается: после отмены новые файлы не обрабатываются,
+// а результат помечается как неполный.
+func (d *Duplicates) ApplyAllDuplicatesContext(ctx context.Context, action Action) *RemoveResult {
+	reviews := make(map[string]Review, len(d.files))
+	for key, files := range d.files {
+		reviews[key] = Review{Kept: files[:1], Duplicates: files[1:]}
+	}
+
+	return d.applyReviews(ctx, action, reviews)
+}
+
+// applyReviews обрабатывает выбранным действием дубликаты групп, по которым принято решение
+func (d *Duplicates) applyReviews(ctx context.Context, action Action, reviews map[string]Review) *RemoveResult {
+	result := &RemoveResult{}
+
+	var duplicates int64
+	for _, review := range reviews {
+		duplicates += int64(len(review.Duplicates))
+	}
+	atomic.StoreInt64(&d.progress.duplicates, duplicates)
+	atomic.StoreInt64(&d.progress.processed, 0)
+	d.progress.setStage(ProgressApply)
+	stopProgress := d.startProgress()
+	defer stopProgress()
+
+	for fileSetKey, review := range reviews {
 		d.Add(1)
-		go d.removeFileDuplicates(fileSetKey)
+		go d.applyFileDuplicates(ctx, fileSetKey, review, action, result)
 	}
 
 	d.Wait()
+
+	return result
 }
 
-// removeFileDuplicates удаляет дубликаты одного файла
-func (d *Duplicates) removeFileDuplicates(fileSetKey string) {
+// applyFileDuplicates обрабатывает дубликаты одного файла
+func (d *Duplicates) applyFileDuplicates(ctx context.Context, fileSetKey string, review Review, action Action, result *RemoveResult) {
 	defer d.Done()
 
-	files, ok := d.files[fileSetKey]
-	if !ok {
-		return
+	kept := review.Kept[0]
+	if d.journal != nil && kept.Hash == "" {
+		// В журнал записывается хэш оставленного файла, по которому проверяется содержимое при отмене действия
+		hash, err := d.fullHash(ctx, &kept)
+		if err != nil {
+			d.Lock()
+			if ctx.Err() != nil {
+				result.Incomplete = true
+			} else {
+				result.Errors = append(result.Errors, d.pathError(OpHash, kept.Path, err))
+			}
+			d.Unlock()
+			return
+		}
+		kept.Hash = hash
 	}
 
-	for fileInd, file := range files {
-		if fileInd != 0 {
-			d.logger.Info("Removing file " + file.Path)
-			err := d.fs.Remove(file.Path)
-			if err != nil {
-				d.logger.Error("Removing file " + file.Path)
-				_, _ = fmt.Fprintln(os.Stderr, err)
+	for _, file := range review.Duplicates {
+		if ctx.Err() != nil {
+			d.Lock()
+			result.Incomplete = true
+			d.Unlock()
+			return
+		}
+
+		if d.verify {
+			if err := d.compareContent(ctx, kept, file); err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				d.logger.Warn("Skip processing file " + file.Path)
+				d.Lock()
+				result.Skipped = append(result.Skipped, SkippedFile{File: file, Kept: kept, Reason: err})
+				d.Unlock()
+				continue
 			}
 		}
+
+		d.logger.Info("Processing file "+file.Path, zap.Stringer("action", action))
+		target, err := action.Apply(d.fs, kept, file)
+		if err != nil {
+			pathErr := d.pathError(action.String(), file.Path, err)
+			d.Lock()
+			result.Errors = append(result.Errors, pathErr)
+			d.Unlock()
+			continue
+		}
+
+		var journalErr *PathError
+		if d.journal != nil {
+			if err = d.journal.Record(fileSetKey, action, kept, file, target); err != nil {
+				journalErr = d.pathError(OpJournal, file.Path, err)
+			}
+		}
+
+		atomic.AddInt64(&d.progress.processed, 1)
+
+		d.Lock()
+		result.Removed = append(result.Removed, file)
+		if journalErr != nil {
+			result.Errors = append(result.Errors, journalErr)
+		}
+		d.Unlock()
 	}
 }
 
-// filterFiles фильтрует найденные файлы и сортирует дубликаты
+// filterFiles фильтрует найденные файлы и сортирует дубликаты.
+// Жесткие и символические ссылки на оставляемый файл убираются из группы: это тот же физический файл.
 func (d *Duplicates) filterFiles() {
-	minFileFilter := 2
 	for ind, dFiles := range d.files {
-		if len(dFiles) < minFileFilter {
+		if len(dFiles) < minGroupSize {
 			delete(d.files, ind)
 			continue
 		}
 
-		sort.Sort(byFilePath(dFiles))
-	}
-}
+		sort.Sort(byKeepPolicy{files: dFiles, policy: d.keep})
 
-// PrintDuplicates Вывод найденных дубликатов
-func (d *Duplicates) PrintDuplicates(out io.Writer) {
-	if len(d.files) == 0 {
-		return
-	}
-
-	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
-	_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t\n", "File Name", "File Path", "File Size")
-
-	keys := make([]string, 0, len(d.files))
-	for k := range d.files {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
+		ordered, ok := orderSymlinks(dFiles)
+		if !ok {
+			delete(d.files, ind)
+			continue
+		}
 
-	for _, key := range keys {
-		for _, file := range d.files[key] {
-			_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t\n", file.Name, file.Path, file.Size)
+		dFiles = withoutKeptLinks(ordered)
+		if len(dFiles) < minGroupSize {
+			delete(d.files, ind)
+			continue
 		}
+		d.files[ind] = dFiles
 	}
-	_ = w.Flush()
-}
-
-// byFilePath Сортирует слайс имен файлов
-type byFilePath []File
-
-func (f byFilePath) Len() int {
-	return len(f)
 }
 
-func (f byFilePath) Swap(i, j int) {
-	f[i], f[j] = f[j], f[i]
-}
-
-func (f byFilePath) Less(i, j int) bool {
-	return len(f[i].Path) < len(f[j].Path)
+// PrintDuplicates Вывод найденных дубликатов и сводки
+func (d *Duplicates) PrintDuplicates(out io.Writer) {
+	_ = d.WriteDuplicates(out, TableFormatter{})
 }
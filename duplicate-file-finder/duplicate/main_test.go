@@ -2,16 +2,32 @@ package duplicate
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 )
 
 type MemoryDuplicatesTestSuite struct {
 	suite.Suite
+	fs     *FileSystemMock
+	logger *zap.Logger
 	finder *Duplicates
 }
 
@@ -26,9 +42,9 @@ func (s *MemoryDuplicatesTestSuite) SetupTest() {
 		}
 	}
 
-	logger := zaptest.NewLogger(s.T())
-	fs := NewFileSystemMock(FileSystemTreeCopy)
-	s.finder = NewDuplicateFinder(fs, logger)
+	s.logger = zaptest.NewLogger(s.T())
+	s.fs = NewFileSystemMock(FileSystemTreeCopy)
+	s.finder = NewDuplicateFinder(s.fs, s.logger)
 }
 
 func (s *MemoryDuplicatesTestSuite) TestDuplicatesSeek() {
@@ -38,7 +54,8 @@ func (s *MemoryDuplicatesTestSuite) TestDuplicatesSeek() {
 		}
 
 		s.T().Run(tt.Name, func(t *testing.T) {
-			dFiles := s.finder.Seek(tt.StartDir, tt.MaxDepth)
+			s.finder = NewDuplicateFinder(s.fs, s.logger, WithMatch(tt.Match))
+			dFiles := s.finder.Seek(tt.StartDir, tt.MaxDepth).Files
 			assert.Equal(t, tt.WantResult, dFiles)
 		})
 	}
@@ -51,6 +68,7 @@ func (s *MemoryDuplicatesTestSuite) TestPrintDuplicates() {
 		}
 
 		s.T().Run(tt.Name, func(t *testing.T) {
+			s.finder = NewDuplicateFinder(s.fs, s.logger, WithMatch(tt.Match))
 			_ = s.finder.Seek(tt.StartDir, tt.MaxDepth)
 
 			out := new(bytes.Buffer)
@@ -61,6 +79,98 @@ func (s *MemoryDuplicatesTestSuite) TestPrintDuplicates() {
 	}
 }
 
+func (s *MemoryDuplicatesTestSuite) TestWriteDuplicatesFormats() {
+	finder := NewDuplicateFinder(s.fs, s.logger)
+	_ = finder.Seek("./tmp", 2)
+
+	out := new(bytes.Buffer)
+	s.Require().NoError(finder.WriteDuplicates(out, FdupesFormatter{}))
+	s.Equal("tmp/copy1.txt\ntmp/A/copy1.txt\n\ntmp/copy2.txt\ntmp/B/copy2.txt\n\n", out.String())
+
+	out.Reset()
+	s.Require().NoError(finder.WriteDuplicates(out, CSVFormatter{}))
+	s.Equal(`key,match,kept,name,path,root,size,mtime,wasted_bytes
+copy1.txt_28,name,true,copy1.txt,tmp/copy1.txt,tmp,28,2021-03-01T12:00:00Z,28
+copy1.txt_28,name,false,copy1.txt,tmp/A/copy1.txt,tmp,28,2021-03-01T12:00:00Z,28
+copy2.txt_28,name,true,copy2.txt,tmp/copy2.txt,tmp,28,2021-03-01T12:00:00Z,28
+copy2.txt_28,name,false,copy2.txt,tmp/B/copy2.txt,tmp,28,2021-03-01T12:00:00Z,28
+`, out.String())
+	s.False(HasSummary(CSVFormatter{}))
+	s.False(HasSummary(FdupesFormatter{}))
+	s.True(HasSummary(TableFormatter{}))
+	s.True(HasSummary(JSONLinesFormatter{}))
+
+	out.Reset()
+	s.Require().NoError(finder.WriteSummary(out))
+	s.Contains(out.String(), "Duplicate Groups|      2|")
+	s.Contains(out.String(), "Reclaimable|   56 B|")
+
+	out.Reset()
+	s.Require().NoError(finder.WriteDuplicates(out, JSONFormatter{}))
+	var report jsonReport
+	s.Require().NoError(json.Unmarshal(out.Bytes(), &report))
+	s.Equal("name", report.Match)
+	s.Require().Len(report.Groups, 2)
+	s.Equal(jsonGroup{
+		Key:         "copy1.txt_28",
+		Match:       "name",
+		WastedBytes: 28,
+		Files: []jsonFile{
+			{Name: "copy1.txt", Path: "tmp/copy1.txt", Root: "tmp", Size: 28, ModTime: TestModTime, Kept: true},
+			{Name: "copy1.txt", Path: "tmp/A/copy1.txt", Root: "tmp", Size: 28, ModTime: TestModTime},
+		},
+	}, report.Groups[0])
+	s.Equal(jsonSummary{
+		Files:            6,
+		Dirs:             3,
+		Groups:           2,
+		Duplicates:       2,
+		ReclaimableBytes: 56,
+		TopGroups:        []jsonGroupSummary{{Key: "copy1.txt_28", Files: 2, WastedBytes: 28}, {Key: "copy2.txt_28", Files: 2, WastedBytes: 28}},
+		TopDirs:          []jsonDirSummary{{Dir: "tmp/A", Files: 1, Bytes: 28}, {Dir: "tmp/B", Files: 1, Bytes: 28}},
+	}, report.Summary)
+
+	out.Reset()
+	s.Require().NoError(finder.WriteDuplicates(out, JSONLinesFormatter{}))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	s.Require().Len(lines, 3)
+	var group jsonGroup
+	s.Require().NoError(json.Unmarshal([]byte(lines[1]), &group))
+	s.Equal("copy2.txt_28", group.Key)
+	s.Equal(int64(28), group.WastedBytes)
+	var summary jsonSummaryLine
+	s.Require().NoError(json.Unmarshal([]byte(lines[2]), &summary))
+	s.Equal(report.Summary, summary.Summary)
+}
+
+func (s *MemoryDuplicatesTestSuite) TestWriteDuplicatesScript() {
+	finder := NewDuplicateFinder(s.fs, s.logger)
+	_ = finder.Seek("./tmp", 2)
+
+	out := new(bytes.Buffer)
+	s.Require().NoError(finder.WriteDuplicates(out, ScriptFormatter{Action: HardlinkAction{}, Dir: "/home/user's"}))
+	s.Equal(`#!/bin/sh
+# duplicate-file-finder: action=hardlink match=name
+set -e
+cd -- '/home/user'\''s'
+
+# group: "copy1.txt_28"
+# keep: "tmp/copy1.txt"
+test -e 'tmp/copy1.txt'
+cmp -s -- 'tmp/copy1.txt' 'tmp/A/copy1.txt' || { printf 'content differs: %s\n' 'tmp/A/copy1.txt' >&2; exit 1; }
+ln -f -- 'tmp/copy1.txt' 'tmp/A/copy1.txt'
+
+# group: "copy2.txt_28"
+# keep: "tmp/copy2.txt"
+test -e 'tmp/copy2.txt'
+cmp -s -- 'tmp/copy2.txt' 'tmp/B/copy2.txt' || { printf 'content differs: %s\n' 'tmp/B/copy2.txt' >&2; exit 1; }
+ln -f -- 'tmp/copy2.txt' 'tmp/B/copy2.txt'
+`, out.String())
+
+	err := finder.WriteDuplicates(out, ScriptFormatter{Action: QuarantineAction{Dir: "trash"}})
+	s.True(errors.Is(err, ErrActionNotScriptable))
+}
+
 func (s *MemoryDuplicatesTestSuite) TestRemoveAllDuplicates() {
 	for ind, tt := range FilesTestData {
 		if ind != 0 {
@@ -68,10 +178,18 @@ func (s *MemoryDuplicatesTestSuite) TestRemoveAllDuplicates() {
 		}
 
 		s.T().Run(tt.Name, func(t *testing.T) {
+			s.finder = NewDuplicateFinder(s.fs, s.logger, WithMatch(tt.Match))
 			_ = s.finder.Seek(tt.StartDir, tt.MaxDepth)
 			mock := s.finder.fs.(*FileSystemMock)
 
-			s.finder.RemoveAllDuplicates()
+			result := s.finder.RemoveAllDuplicates()
+
+			removed := make([]string, 0, len(result.Removed))
+			for _, file := range result.Removed {
+				removed = append(removed, file.Path)
+			}
+			assert.ElementsMatch(t, tt.WantDeletedFiles, removed)
+			assert.Empty(t, result.Skipped)
 
 			for _, filePath := range tt.WantDeletedFiles {
 				dir := filepath.Dir(filePath)
@@ -92,6 +210,1262 @@ func (s *MemoryDuplicatesTestSuite) TestRemoveAllDuplicates() {
 	}
 }
 
+func (s *MemoryDuplicatesTestSuite) TestHardlinkAllDuplicates() {
+	finder := NewDuplicateFinder(s.fs, s.logger, WithMatch(MatchContent))
+	dFiles := finder.Seek("./tmp", 0).Files
+
+	result := finder.ApplyAllDuplicates(HardlinkAction{})
+	s.Empty(result.Skipped)
+	s.Len(result.Removed, 4)
+
+	for _, group := range dFiles {
+		kept := s.fs.fileSystem[filepath.Dir(group[0].Path)][group[0].Name]
+		for _, file := range group[1:] {
+			linked, ok := s.fs.fileSystem[filepath.Dir(file.Path)][file.Name]
+			if s.True(ok, file.Path) {
+				s.Equal(kept.content, linked.content)
+			}
+		}
+	}
+
+	for dir, files := range s.fs.fileSystem {
+		for name := range files {
+			s.False(strings.HasPrefix(name, "."), "temp file %s left in %s", name, dir)
+		}
+	}
+}
+
+func (s *MemoryDuplicatesTestSuite) TestSymlinkAllDuplicates() {
+	for _, relative := range []bool{false, true} {
+		s.SetupTest()
+		finder := NewDuplicateFinder(s.fs, s.logger)
+		_ = finder.Seek("./tmp", 0)
+
+		result := finder.ApplyAllDuplicates(SymlinkAction{Relative: relative})
+		s.Len(result.Removed, 3)
+
+		link := s.fs.fileSystem["tmp/A/AA"]["copy1.txt"]
+		s.Equal(os.ModeSymlink, link.mode)
+		if relative {
+			s.Equal("../../copy1.txt", link.target)
+		} else {
+			target, err := filepath.Abs("tmp/copy1.txt")
+			s.Require().NoError(err)
+			s.Equal(target, link.target)
+		}
+	}
+}
+
+func (s *MemoryDuplicatesTestSuite) TestQuarantineAndRestore() {
+	manifest := new(bytes.Buffer)
+	finder := NewDuplicateFinder(s.fs, s.logger)
+	_ = finder.Seek("./tmp", 0)
+
+	result := finder.ApplyAllDuplicates(QuarantineAction{Dir: "trash", Manifest: NewManifest(manifest)})
+	s.Len(result.Removed, 3)
+	s.NotContains(s.fs.fileSystem["tmp/A"], "copy1.txt")
+	s.Equal("Some content for ./copy1.txt", s.fs.fileSystem["trash/files/tmp/A"]["copy1.txt"].content)
+
+	entries, err := ReadManifest(manifest)
+	s.Require().NoError(err)
+	s.Len(entries, 3)
+
+	s.fs.fileSystem["tmp/B"]["copy2.txt"] = FileInfoMock{name: "copy2.txt", content: "New file"}
+
+	restored := Restore(s.fs, entries)
+	s.Len(restored.Restored, 2)
+	if s.Len(restored.Failed, 1) {
+		s.Equal("tmp/B/copy2.txt", restored.Failed[0].Entry.Original)
+		s.True(errors.Is(restored.Failed[0].Reason, ErrRestoreTargetExists))
+	}
+
+	s.Equal("Some content for ./copy1.txt", s.fs.fileSystem["tmp/A"]["copy1.txt"].content)
+	s.Equal("New file", s.fs.fileSystem["tmp/B"]["copy2.txt"].content)
+	s.NotContains(s.fs.fileSystem["trash/files/tmp/A"], "copy1.txt")
+	s.Contains(s.fs.fileSystem["trash/files/tmp/B"], "copy2.txt")
+}
+
+func (s *MemoryDuplicatesTestSuite) TestJournalUndo() {
+	actions := []Action{HardlinkAction{}, SymlinkAction{Relative: true}, QuarantineAction{Dir: "trash"}, RemoveAction{}}
+	for _, action := range actions {
+		s.SetupTest()
+		journal := new(bytes.Buffer)
+		finder := NewDuplicateFinder(s.fs, s.logger, WithMatch(MatchContent), WithJournal(NewJournal(journal, "")))
+		_ = finder.Seek("./tmp", 0)
+		_ = finder.ApplyAllDuplicates(action)
+
+		entries, err := ReadJournal(journal)
+		s.Require().NoError(err)
+		s.Len(entries, 4, action.String())
+		for _, entry := range entries {
+			s.Equal(action.String(), entry.Action)
+			s.NotEmpty(entry.Hash)
+			s.Equal(TestModTime, entry.ModTime)
+		}
+
+		result := Undo(s.fs, entries)
+		if _, ok := action.(RemoveAction); ok {
+			s.Empty(result.Undone)
+			for _, failed := range result.Failed {
+				s.True(errors.Is(failed.Reason, ErrNotReversible))
+			}
+			continue
+		}
+
+		s.Len(result.Undone, 4, action.String())
+		s.Empty(result.Failed, action.String())
+		for _, entry := range entries {
+			file := s.fs.fileSystem[filepath.Dir(entry.Removed)][filepath.Base(entry.Removed)]
+			s.True(file.mode.IsRegular(), entry.Removed)
+			s.Equal(FileSystemTree[filepath.Dir(entry.Removed)][filepath.Base(entry.Removed)].content, file.content)
+			s.Equal(TestModTime, file.modeTime)
+		}
+	}
+}
+
+func (s *MemoryDuplicatesTestSuite) TestJournalUndoQuarantineManifest() {
+	journal, manifest := new(bytes.Buffer), new(bytes.Buffer)
+	finder := NewDuplicateFinder(s.fs, s.logger, WithMatch(MatchContent), WithJournal(NewJournal(journal, "")))
+	_ = finder.Seek("./tmp", 0)
+	_ = finder.ApplyAllDuplicates(QuarantineAction{Dir: "trash", Manifest: NewManifest(manifest)})
+
+	entries, err := ReadJournal(journal)
+	s.Require().NoError(err)
+	quarantined, err := ReadManifest(manifest)
+	s.Require().NoError(err)
+	s.Require().Len(entries, 4)
+	for _, entry := range entries {
+		s.Equal("trash", entry.Trash)
+	}
+
+	result := Undo(s.fs, entries[:3])
+	s.Require().Len(result.Undone, 3)
+	remaining := PruneManifest(quarantined, result.Undone)
+	if s.Len(remaining, 1) {
+		s.Equal(entries[3].Target, remaining[0].Quarantined)
+	}
+
+	restored := Restore(s.fs, remaining)
+	s.Len(restored.Restored, 1)
+	s.Empty(restored.Failed)
+}
+
+func (s *MemoryDuplicatesTestSuite) TestJournalUndoMismatch() {
+	journal := new(bytes.Buffer)
+	finder := NewDuplicateFinder(s.fs, s.logger, WithJournal(NewJournal(journal, "")))
+	_ = finder.Seek("./tmp", 0)
+	_ = finder.ApplyAllDuplicates(HardlinkAction{})
+
+	entries, err := ReadJournal(journal)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(entries)
+	for _, entry := range entries {
+		s.NotEmpty(entry.Hash, entry.Removed)
+	}
+
+	entry := entries[0]
+	dir, name := filepath.Dir(entry.Removed), filepath.Base(entry.Removed)
+	changed := s.fs.fileSystem[dir][name]
+	changed.content = strings.Repeat("x", len(changed.content))
+	s.fs.fileSystem[dir][name] = changed
+
+	result := Undo(s.fs, entries[:1])
+	s.Empty(result.Undone)
+	if s.Len(result.Failed, 1) {
+		s.True(errors.Is(result.Failed[0].Reason, ErrJournalMismatch))
+	}
+	s.Equal(changed.content, s.fs.fileSystem[dir][name].content)
+}
+
 func TestMemoryDuplicatesTestSuite(t *testing.T) {
 	suite.Run(t, new(MemoryDuplicatesTestSuite))
 }
+
+func TestPipelineStats(t *testing.T) {
+	block := strings.Repeat("a", 5000)
+	fs := NewFileSystemMock(FileSystemStruct{
+		"big": {
+			"a.bin": {name: "a.bin", content: block + block},
+			"b.bin": {name: "b.bin", content: block + block},
+			"c.bin": {name: "c.bin", content: block + block[1:] + "b"},
+			"d.bin": {name: "d.bin", content: block + "x" + block[1:]},
+			"e.bin": {name: "e.bin", content: block},
+		},
+	})
+	finder := NewDuplicateFinder(fs, zaptest.NewLogger(t), WithMatch(MatchContent))
+
+	dFiles := finder.Seek("big", 0).Files
+	assert.Len(t, dFiles, 1)
+	for _, group := range dFiles {
+		paths := make([]string, 0, len(group))
+		for _, file := range group {
+			paths = append(paths, file.Path)
+		}
+		assert.ElementsMatch(t, []string{"big/a.bin", "big/b.bin"}, paths)
+	}
+
+	assert.Equal(t, PipelineStats{
+		Size:    StageStats{Files: 5},
+		Partial: StageStats{Files: 4, Bytes: 4 * 2 * partialHashSize},
+		Full:    StageStats{Files: 3, Bytes: 3 * 10000},
+	}, finder.Stats())
+}
+
+func TestRemoveAllDuplicatesVerify(t *testing.T) {
+	tree := FileSystemStruct{
+		"v": {
+			"same.txt": {name: "same.txt", content: "same content"},
+			"diff.txt": {name: "diff.txt", content: "aaaa"},
+			"sub":      {name: "sub", isDir: true},
+		},
+		"v/sub": {
+			"same.txt": {name: "same.txt", content: "same content"},
+			"diff.txt": {name: "diff.txt", content: "bbbb"},
+		},
+	}
+	fs := NewFileSystemMock(tree)
+	finder := NewDuplicateFinder(fs, zaptest.NewLogger(t), WithVerify(true))
+
+	_ = finder.Seek("v", 0)
+	result := finder.RemoveAllDuplicates()
+
+	if assert.Len(t, result.Removed, 1) {
+		assert.Equal(t, "v/sub/same.txt", result.Removed[0].Path)
+	}
+	if assert.Len(t, result.Skipped, 1) {
+		skipped := result.Skipped[0]
+		assert.Equal(t, "v/sub/diff.txt", skipped.File.Path)
+		assert.Equal(t, "v/diff.txt", skipped.Kept.Path)
+		assert.True(t, errors.Is(skipped.Reason, ErrContentMismatch))
+	}
+	assert.Contains(t, tree["v/sub"], "diff.txt")
+}
+
+func TestKeepPolicy(t *testing.T) {
+	older := TestModTime.Add(-time.Hour)
+	newer := TestModTime.Add(time.Hour)
+	files := []File{
+		{Name: "b.jpg", Path: "photos/2020/b.jpg", ModTime: TestModTime},
+		{Name: "a.jpg", Path: "backup/a.jpg", ModTime: newer},
+		{Name: "c.jpg", Path: "backup/c.jpg", ModTime: older},
+		{Name: "copy.jpg", Path: "tmp/x/copy.jpg", ModTime: older},
+	}
+
+	tests := []struct {
+		specs    []string
+		wantKept string
+	}{
+		{specs: nil, wantKept: "backup/a.jpg"},
+		{specs: []string{"shortest"}, wantKept: "backup/a.jpg"},
+		{specs: []string{"oldest"}, wantKept: "backup/c.jpg"},
+		{specs: []string{"newest"}, wantKept: "backup/a.jpg"},
+		{specs: []string{"lexical"}, wantKept: "backup/a.jpg"},
+		{specs: []string{"glob:copy*"}, wantKept: "tmp/x/copy.jpg"},
+		{specs: []string{"glob:photos/*/*.jpg"}, wantKept: "photos/2020/b.jpg"},
+		{specs: []string{"regex:^photos/"}, wantKept: "photos/2020/b.jpg"},
+		{specs: []string{"dir:tmp"}, wantKept: "tmp/x/copy.jpg"},
+		{specs: []string{"dir:backup", "oldest"}, wantKept: "backup/c.jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.specs, ","), func(t *testing.T) {
+			policies := make([]KeepPolicy, 0, len(tt.specs))
+			for _, spec := range tt.specs {
+				policy, err := ParseKeepPolicy(spec)
+				if !assert.NoError(t, err) {
+					return
+				}
+				policies = append(policies, policy)
+			}
+
+			finder := NewDuplicateFinder(NewFileSystemMock(FileSystemStruct{}), zaptest.NewLogger(t), WithKeepPolicy(policies...))
+			group := make([]File, len(files))
+			copy(group, files)
+			finder.files = Files{"key": group}
+			finder.filterFiles()
+
+			assert.Equal(t, tt.wantKept, finder.files["key"][0].Path)
+		})
+	}
+
+	_, err := ParseKeepPolicy("largest")
+	assert.True(t, errors.Is(err, ErrUnknownKeepPolicy))
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+	absolute, err := ParseKeepPolicy("dir:" + filepath.Join(workDir, "backup"))
+	require.NoError(t, err)
+	assert.Equal(t, -1, absolute.Compare(File{Path: "backup/a.jpg"}, File{Path: "tmp/a.jpg"}))
+
+	relative, err := ParseKeepPolicy("dir:backup/")
+	require.NoError(t, err)
+	assert.Equal(t, 1, relative.Compare(File{Path: "backup2/a.jpg"}, File{Path: filepath.Join(workDir, "backup", "a.jpg")}))
+}
+
+func TestFilter(t *testing.T) {
+	tree := FileSystemStruct{
+		"w": {
+			".gitignore":    {name: ".gitignore", content: "# build output\n*.log\n!keep.log\nbuild/\n/root-only.txt\n"},
+			".hidden.txt":   {name: ".hidden.txt", content: "h"},
+			"a.txt":         {name: "a.txt", content: "aaaa"},
+			"b.md":          {name: "b.md", content: "bb"},
+			"a.log":         {name: "a.log", content: "l"},
+			"keep.log":      {name: "keep.log", content: "k"},
+			"root-only.txt": {name: "root-only.txt", content: "r"},
+			"big.bin":       {name: "big.bin", content: strings.Repeat("b", 100)},
+			".git":          {name: ".git", isDir: true},
+			"node_modules":  {name: "node_modules", isDir: true},
+			"build":         {name: "build", isDir: true},
+			"src":           {name: "src", isDir: true},
+		},
+		"w/.git":         {"config": {name: "config", content: "c"}},
+		"w/node_modules": {"x.js": {name: "x.js", content: "j"}},
+		"w/build":        {"out.txt": {name: "out.txt", content: "o"}},
+		"w/src": {
+			".ignore":       {name: ".ignore", content: "*.tmp\n"},
+			"main.go":       {name: "main.go", content: "m"},
+			"root-only.txt": {name: "root-only.txt", content: "r"},
+			"x.tmp":         {name: "x.tmp", content: "t"},
+			"sub":           {name: "sub", isDir: true},
+		},
+		"w/src/sub": {
+			"c.go":  {name: "c.go", content: "c"},
+			"y.tmp": {name: "y.tmp", content: "t"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{
+			name:   "Exclude",
+			filter: Filter{Exclude: []string{".git", "node_modules", "src/**/*.tmp"}},
+			want: []string{
+				"w/.gitignore", "w/.hidden.txt", "w/a.log", "w/a.txt", "w/b.md", "w/big.bin", "w/build/out.txt",
+				"w/keep.log", "w/root-only.txt", "w/src/.ignore", "w/src/main.go", "w/src/root-only.txt", "w/src/sub/c.go",
+			},
+		},
+		{
+			name:   "Include",
+			filter: Filter{Include: []string{"src/**/*.go"}},
+			want:   []string{"w/src/main.go", "w/src/sub/c.go"},
+		},
+		{
+			name:   "Size",
+			filter: Filter{MinSize: 2, MaxSize: 99},
+			want:   []string{"w/.gitignore", "w/a.txt", "w/b.md", "w/src/.ignore"},
+		},
+		{
+			name:   "Extensions",
+			filter: Filter{Extensions: []string{"txt", ".MD"}, ExcludeExtensions: []string{"txt"}},
+			want:   []string{"w/b.md"},
+		},
+		{
+			name:   "Skip Hidden",
+			filter: Filter{SkipHidden: true, Exclude: []string{"*.log", "*.tmp", "*.bin"}},
+			want: []string{
+				"w/a.txt", "w/b.md", "w/build/out.txt", "w/node_modules/x.js",
+				"w/root-only.txt", "w/src/main.go", "w/src/root-only.txt", "w/src/sub/c.go",
+			},
+		},
+		{
+			name:   "Ignore Files",
+			filter: Filter{IgnoreFiles: true, Exclude: []string{".git", "node_modules"}},
+			want: []string{
+				"w/.gitignore", "w/.hidden.txt", "w/a.txt", "w/b.md", "w/big.bin", "w/keep.log",
+				"w/src/.ignore", "w/src/main.go", "w/src/root-only.txt", "w/src/sub/c.go",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tt.filter.Validate())
+
+			finder := NewDuplicateFinder(NewFileSystemMock(tree), zaptest.NewLogger(t), WithFilter(tt.filter))
+			_ = finder.Seek("w", 0)
+
+			scanned := make([]string, 0, len(finder.scanned))
+			for _, file := range finder.scanned {
+				scanned = append(scanned, file.Path)
+			}
+			sort.Strings(scanned)
+
+			assert.Equal(t, tt.want, scanned)
+		})
+	}
+
+	assert.Error(t, Filter{Include: []string{"[a-"}}.Validate())
+}
+
+// concurrencyFS считает наибольшее количество одновременных чтений директорий
+type concurrencyFS struct {
+	*FileSystemMock
+	delay   time.Duration
+	current int64
+	peak    int64
+}
+
+func (f *concurrencyFS) ReadDir(dirPath string) ([]os.FileInfo, error) {
+	current := atomic.AddInt64(&f.current, 1)
+	defer atomic.AddInt64(&f.current, -1)
+
+	for {
+		peak := atomic.LoadInt64(&f.peak)
+		if current <= peak || atomic.CompareAndSwapInt64(&f.peak, peak, current) {
+			break
+		}
+	}
+	time.Sleep(f.delay)
+
+	return f.FileSystemMock.ReadDir(dirPath)
+}
+
+// deepTree создает дерево из width поддиректорий на каждом из depth уровней, в каждой директории по files файлов
+func deepTree(width, depth, files int) FileSystemStruct {
+	tree := make(FileSystemStruct)
+
+	var fill func(dir string, level int)
+	fill = func(dir string, level int) {
+		entries := make(map[string]FileInfoMock)
+		for i := 0; i < files; i++ {
+			name := fmt.Sprintf("file%d.txt", i)
+			entries[name] = FileInfoMock{name: name, content: name, modeTime: TestModTime}
+		}
+
+		if level < depth {
+			for i := 0; i < width; i++ {
+				name := fmt.Sprintf("dir%d", i)
+				entries[name] = FileInfoMock{name: name, isDir: true}
+				fill(dir+"/"+name, level+1)
+			}
+		}
+		tree[dir] = entries
+	}
+	fill("root", 0)
+
+	return tree
+}
+
+// scanUnbounded обход директорий горутиной на каждую директорию, как до появления пула воркеров
+func scanUnbounded(d *Duplicates, dirPath string, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	list, err := d.fs.ReadDir(dirPath)
+	if err != nil {
+		return
+	}
+
+	for _, val := range list {
+		currPath := filepath.Join(dirPath, val.Name())
+		if val.IsDir() {
+			wg.Add(1)
+			go scanUnbounded(d, currPath, wg)
+			continue
+		}
+
+		d.Lock()
+		d.scanned = append(d.scanned, File{Name: val.Name(), Path: currPath, Size: val.Size(), ModTime: val.ModTime().UTC()})
+		d.Unlock()
+	}
+}
+
+func TestBoundedJobs(t *testing.T) {
+	fs := &concurrencyFS{FileSystemMock: NewFileSystemMock(deepTree(3, 3, 2)), delay: time.Millisecond}
+	finder := NewDuplicateFinder(fs, zap.NewNop(), WithJobs(2), WithHashJobs(1), WithMatch(MatchContent))
+	files := finder.Seek("root", 0).Files
+
+	assert.LessOrEqual(t, fs.peak, int64(2))
+	assert.Len(t, finder.scanned, 2*(1+3+9+27))
+	assert.Len(t, files, 2)
+	for _, group := range files {
+		assert.Len(t, group, 1+3+9+27)
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	tree := deepTree(4, 6, 3)
+
+	b.Run("Bounded", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			finder := NewDuplicateFinder(NewFileSystemMock(tree), zap.NewNop())
+			finder.walk(context.Background(), newSeekRoots([]string{"root"}), 0)
+		}
+	})
+
+	b.Run("Unbounded", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			finder := NewDuplicateFinder(NewFileSystemMock(tree), zap.NewNop())
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go scanUnbounded(finder, "root", &wg)
+			wg.Wait()
+		}
+	})
+}
+
+func BenchmarkSeekContent(b *testing.B) {
+	tree := deepTree(4, 5, 3)
+
+	for _, jobs := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("Jobs%d", jobs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				finder := NewDuplicateFinder(NewFileSystemMock(tree), zap.NewNop(),
+					WithMatch(MatchContent), WithJobs(jobs), WithHashJobs(jobs))
+				_ = finder.Seek("root", 0)
+			}
+		})
+	}
+}
+
+// cancelFS отменяет контекст после limit чтений директорий
+type cancelFS struct {
+	*FileSystemMock
+	cancel context.CancelFunc
+	limit  int64
+	reads  int64
+}
+
+func (f *cancelFS) ReadDir(dirPath string) ([]os.FileInfo, error) {
+	if atomic.AddInt64(&f.reads, 1) >= f.limit {
+		f.cancel()
+	}
+
+	return f.FileSystemMock.ReadDir(dirPath)
+}
+
+func TestSeekContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs := &cancelFS{FileSystemMock: NewFileSystemMock(deepTree(3, 4, 2)), cancel: cancel, limit: 5}
+	finder := NewDuplicateFinder(fs, zap.NewNop(), WithJobs(1), WithMatch(MatchContent))
+	result := finder.SeekContext(ctx, "root", 0)
+
+	assert.True(t, result.Incomplete)
+	assert.Equal(t, int64(5), fs.reads)
+	assert.Empty(t, result.Files)
+
+	finder = NewDuplicateFinder(NewFileSystemMock(deepTree(3, 4, 2)), zap.NewNop(), WithJobs(1))
+	result = finder.SeekContext(context.Background(), "root", 0)
+	assert.False(t, result.Incomplete)
+	assert.Len(t, result.Files, 2)
+
+	removed := finder.ApplyAllDuplicatesContext(ctx, RemoveAction{})
+	assert.True(t, removed.Incomplete)
+	assert.Empty(t, removed.Removed)
+}
+
+func TestPathErrors(t *testing.T) {
+	fs := NewFileSystemMock(FileSystemStruct{
+		"e": {
+			"locked": {name: "locked", isDir: true, denied: true},
+			"a.txt":  {name: "a.txt", content: "same"},
+			"b.txt":  {name: "b.txt", content: "same"},
+			"c.txt":  {name: "c.txt", content: "same", denied: true},
+			"sub":    {name: "sub", isDir: true},
+		},
+		"e/locked": {"d.txt": {name: "d.txt", content: "same"}},
+		"e/sub": {
+			"a.txt": {name: "a.txt", content: "same"},
+			"b.txt": {name: "b.txt", content: "same", denied: true},
+		},
+	})
+
+	finder := NewDuplicateFinder(fs, zaptest.NewLogger(t), WithMatch(MatchContent))
+	result := finder.Seek("e", 0)
+
+	assert.False(t, result.Incomplete)
+	if assert.Len(t, result.Errors, 3) {
+		err := result.Errors.Err()
+		assert.True(t, errors.Is(err, os.ErrPermission))
+		assert.False(t, errors.Is(err, ErrFileVanished))
+
+		var pathErr *PathError
+		if assert.True(t, errors.As(err, &pathErr)) {
+			assert.Contains(t, []string{OpReadDir, OpHash}, pathErr.Op)
+		}
+	}
+	assert.Len(t, result.Files, 1)
+
+	finder = NewDuplicateFinder(fs, zaptest.NewLogger(t))
+	result = finder.Seek("e", 0)
+	assert.Len(t, result.Errors, 1)
+	assert.NoError(t, fs.Remove("e/sub/a.txt"))
+
+	removed := finder.RemoveAllDuplicates()
+	assert.Empty(t, removed.Removed)
+	if assert.Len(t, removed.Errors, 2) {
+		err := removed.Errors.Err()
+		assert.True(t, errors.Is(err, ErrFileVanished))
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+		assert.True(t, errors.Is(err, os.ErrPermission))
+	}
+	assert.NoError(t, PathErrors(nil).Err())
+}
+
+func TestProgress(t *testing.T) {
+	var mu sync.Mutex
+	var last Progress
+	var calls int
+	onProgress := func(progress Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		last = progress
+		calls++
+	}
+
+	tree := make(FileSystemStruct, len(FileSystemTree))
+	for dir, files := range FileSystemTree {
+		tree[dir] = make(map[string]FileInfoMock, len(files))
+		for name, file := range files {
+			tree[dir][name] = file
+		}
+	}
+
+	finder := NewDuplicateFinder(NewFileSystemMock(tree), zaptest.NewLogger(t),
+		WithMatch(MatchContent), WithProgress(time.Hour, onProgress))
+	_ = finder.Seek("./tmp", 0)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, Progress{
+		Stage:       ProgressHash,
+		Dirs:        5,
+		Files:       8,
+		HashedBytes: last.HashedBytes,
+		Groups:      2,
+		Duplicates:  4,
+	}, last)
+	assert.Greater(t, last.HashedBytes, int64(0))
+
+	_ = finder.RemoveAllDuplicates()
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, ProgressApply, last.Stage)
+	assert.Equal(t, int64(4), last.Processed)
+}
+
+func TestHashCache(t *testing.T) {
+	block := strings.Repeat("c", 3*partialHashSize)
+	tree := FileSystemStruct{
+		"c": {
+			"a.bin":  {name: "a.bin", content: block, modeTime: TestModTime, inode: 1},
+			"b.bin":  {name: "b.bin", content: block, modeTime: TestModTime, inode: 2},
+			"c.txt":  {name: "c.txt", content: "small", modeTime: TestModTime, inode: 3},
+			"d.txt":  {name: "d.txt", content: "small", modeTime: TestModTime, inode: 4},
+			"no.txt": {name: "no.txt", content: "small", modeTime: TestModTime},
+		},
+	}
+	fs := NewFileSystemMock(tree)
+	cache := NewHashCache()
+
+	first := NewDuplicateFinder(fs, zap.NewNop(), WithMatch(MatchContent), WithHashCache(cache)).Seek("c", 0)
+	assert.Equal(t, CacheStats{Hits: 0, Misses: 6, Entries: 4}, cache.Stats())
+
+	saved := new(bytes.Buffer)
+	require.NoError(t, cache.Save(saved))
+	cache, err := LoadHashCache(saved)
+	require.NoError(t, err)
+
+	finder := NewDuplicateFinder(fs, zap.NewNop(), WithMatch(MatchContent), WithHashCache(cache))
+	second := finder.Seek("c", 0)
+	assert.Equal(t, first.Files, second.Files)
+	assert.Equal(t, CacheStats{Hits: 6, Misses: 0, Entries: 4}, cache.Stats())
+	assert.Equal(t, int64(0), finder.Stats().Full.Bytes)
+	assert.Equal(t, 1.0, cache.Stats().HitRate())
+
+	require.NoError(t, fs.Chtimes("c/a.bin", TestModTime.Add(time.Hour), TestModTime.Add(time.Hour)))
+	require.NoError(t, fs.Remove("c/c.txt"))
+	assert.Equal(t, 2, cache.Prune(fs))
+	assert.Equal(t, 2, cache.Stats().Entries)
+}
+
+func TestHashCacheMerge(t *testing.T) {
+	saved := new(bytes.Buffer)
+	saved.WriteString(`{"path":"a","dev":1,"ino":1,"size":4,"mtime":1,"partial":"pa","full":"fa"}` + "\n")
+	saved.WriteString(`{"path":"b","dev":1,"ino":2,"size":4,"mtime":1,"partial":"pb"}` + "\n")
+	saved.WriteString(`{"path":"c","dev":1,"ino":3,"size":4,"mtime":1,"partial":"old"}` + "\n")
+	other, err := LoadHashCache(saved)
+	require.NoError(t, err)
+
+	cache := NewHashCache()
+	cache.store(newCacheKey(FileID{Device: 1, Inode: 2}, 4, 1), "b", "fb", fullField)
+	cache.store(newCacheKey(FileID{Device: 1, Inode: 3}, 4, 1), "c", "new", partialField)
+	cache.Merge(other)
+	assert.Equal(t, 3, cache.Stats().Entries)
+
+	merged := new(bytes.Buffer)
+	require.NoError(t, cache.Save(merged))
+	cache, err = LoadHashCache(merged)
+	require.NoError(t, err)
+	assert.Equal(t, &CacheEntry{Path: "a", Device: 1, Inode: 1, Size: 4, ModTime: 1, Partial: "pa", Full: "fa"},
+		cache.entries[newCacheKey(FileID{Device: 1, Inode: 1}, 4, 1)])
+	assert.Equal(t, &CacheEntry{Path: "b", Device: 1, Inode: 2, Size: 4, ModTime: 1, Partial: "pb", Full: "fb"},
+		cache.entries[newCacheKey(FileID{Device: 1, Inode: 2}, 4, 1)])
+	assert.Equal(t, "new", cache.entries[newCacheKey(FileID{Device: 1, Inode: 3}, 4, 1)].Partial)
+}
+
+func TestHashCacheSymlink(t *testing.T) {
+	tree := FileSystemStruct{
+		"c": {
+			"target.txt": {name: "target.txt", content: "aaaa", modeTime: TestModTime, inode: 1},
+			"link.txt":   {name: "link.txt", mode: os.ModeSymlink, target: "target.txt", modeTime: TestModTime, inode: 2},
+		},
+	}
+	fs := NewFileSystemMock(tree)
+	finder := NewDuplicateFinder(fs, zap.NewNop(), WithMatch(MatchContent), WithHashCache(NewHashCache()))
+
+	link := File{Path: "c/link.txt", Size: 4, Symlink: true}
+	before, err := finder.fullHash(context.Background(), &link)
+	require.NoError(t, err)
+
+	tree["c"]["target.txt"] = FileInfoMock{name: "target.txt", content: "bbbb", modeTime: TestModTime.Add(time.Hour), inode: 1}
+	after, err := finder.fullHash(context.Background(), &link)
+	require.NoError(t, err)
+	assert.NotEqual(t, before, after)
+}
+
+func TestSeekRoots(t *testing.T) {
+	policy, err := ParseKeepPolicy("root:tmp/A/")
+	require.NoError(t, err)
+
+	finder := NewDuplicateFinder(NewFileSystemMock(FileSystemTree), zap.NewNop(), WithKeepPolicy(policy))
+	result := finder.SeekRoots([]string{"tmp/A", "./tmp", "tmp/A/", "tmp/B"}, 0)
+	assert.Empty(t, result.Errors)
+
+	single := NewDuplicateFinder(NewFileSystemMock(FileSystemTree), zap.NewNop())
+	_ = single.Seek("tmp", 0)
+	assert.Len(t, finder.scanned, len(single.scanned))
+
+	roots := make(map[string]string)
+	for _, group := range result.Files {
+		for _, file := range group {
+			roots[file.Path] = file.Root
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"tmp/copy1.txt":      "tmp",
+		"tmp/A/copy1.txt":    "tmp/A",
+		"tmp/A/AA/copy1.txt": "tmp/A",
+		"tmp/copy2.txt":      "tmp",
+		"tmp/B/copy2.txt":    "tmp/B",
+	}, roots)
+
+	assert.Equal(t, "tmp/A/copy1.txt", result.Files["copy1.txt_28"][0].Path)
+	assert.Equal(t, "tmp/copy2.txt", result.Files["copy2.txt_28"][0].Path)
+}
+
+func TestHardLinks(t *testing.T) {
+	const content = "same content"
+	tree := FileSystemStruct{
+		"h": {
+			"a.txt":     {name: "a.txt", content: content, inode: 1, nlink: 2},
+			"b.txt":     {name: "b.txt", content: content, inode: 2, nlink: 1},
+			"c.txt":     {name: "c.txt", content: content, inode: 3, nlink: 2},
+			"d.txt":     {name: "d.txt", content: content, inode: 4, nlink: 2},
+			"solo1.txt": {name: "solo1.txt", content: "solo", inode: 5, nlink: 2},
+			"solo2.txt": {name: "solo2.txt", content: "solo", inode: 5, nlink: 2},
+			"sub":       {name: "sub", isDir: true},
+		},
+		"h/sub": {
+			"a.txt": {name: "a.txt", content: content, inode: 1, nlink: 2},
+			"d.txt": {name: "d.txt", content: content, inode: 4, nlink: 2},
+		},
+	}
+
+	finder := NewDuplicateFinder(NewFileSystemMock(tree), zap.NewNop(), WithMatch(MatchContent))
+	result := finder.Seek("h", 0)
+
+	require.Len(t, result.Files, 1)
+	for _, group := range result.Files {
+		paths := make([]string, len(group))
+		for ind, file := range group {
+			paths[ind] = file.Path
+		}
+		assert.Equal(t, []string{"h/a.txt", "h/b.txt", "h/c.txt", "h/d.txt", "h/sub/d.txt"}, paths)
+		assert.Equal(t, int64(2*len(content)), Group{Files: group}.WastedBytes())
+	}
+	assert.Equal(t, int64(4), finder.Stats().Partial.Files)
+
+	assert.Len(t, result.HardLinks, 3)
+	assert.Len(t, result.HardLinks["1:1"], 2)
+	assert.Equal(t, "h/solo1.txt", result.HardLinks["1:5"][0].Path)
+
+	out := new(bytes.Buffer)
+	require.NoError(t, finder.WriteDuplicates(out, JSONFormatter{}))
+	var report jsonReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, jsonHardLinks{Key: "1:4", Size: int64(len(content)), Paths: []string{"h/d.txt", "h/sub/d.txt"}}, report.HardLinks[1])
+	assert.Equal(t, int64(2*len(content)), report.Groups[0].WastedBytes)
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	const content = "linked content"
+	tree := FileSystemStruct{
+		"r": {"s": {name: "s", isDir: true, inode: 9}},
+		"r/s": {
+			"a.txt":   {name: "a.txt", content: content, inode: 1, nlink: 1},
+			"b.txt":   {name: "b.txt", content: content, inode: 2, nlink: 1},
+			"link-a":  {name: "link-a", mode: os.ModeSymlink, target: "a.txt"},
+			"link-b":  {name: "link-b", mode: os.ModeSymlink, target: "b.txt"},
+			"dir":     {name: "dir", isDir: true, inode: 10},
+			"dirlink": {name: "dirlink", mode: os.ModeSymlink, target: "dir"},
+			"loop":    {name: "loop", mode: os.ModeSymlink, target: "."},
+			"broken":  {name: "broken", mode: os.ModeSymlink, target: "missing"},
+		},
+		"r/s/dir": {
+			"c.txt": {name: "c.txt", content: content, inode: 3, nlink: 1},
+		},
+	}
+
+	finder := NewDuplicateFinder(NewFileSystemMock(tree), zap.NewNop(), WithMatch(MatchContent))
+	result := finder.Seek("r/s", 0)
+	assert.Empty(t, result.Errors)
+	assert.Len(t, finder.scanned, 3)
+	for _, file := range finder.scanned {
+		assert.False(t, file.Symlink, file.Path)
+	}
+
+	policy, err := ParseKeepPolicy("glob:link-*")
+	require.NoError(t, err)
+	finder = NewDuplicateFinder(NewFileSystemMock(tree), zap.NewNop(), WithMatch(MatchContent),
+		WithFollowSymlinks(true), WithKeepPolicy(policy))
+	result = finder.Seek("r/s", 0)
+	assert.Empty(t, result.Errors)
+	assert.Len(t, finder.scanned, 5)
+
+	require.Len(t, result.Files, 1)
+	for _, group := range result.Files {
+		require.Len(t, group, 4)
+		assert.Equal(t, "r/s/a.txt", group[0].Path)
+		assert.Equal(t, "r/s/link-b", group[1].Path)
+		assert.True(t, group[1].Symlink)
+		assert.Contains(t, []string{"r/s/dir/c.txt", "r/s/dirlink/c.txt"}, group[3].Path)
+		assert.Equal(t, int64(2*len(content)), Group{Files: group}.WastedBytes())
+	}
+	assert.Empty(t, result.HardLinks)
+}
+
+func TestSummary(t *testing.T) {
+	finder := NewDuplicateFinder(NewFileSystemMock(FileSystemTree), zap.NewNop(), WithMatch(MatchContent), WithSummaryTop(1))
+	_ = finder.Seek("tmp", 0)
+
+	summary := finder.Summary()
+	assert.Equal(t, int64(8), summary.Files)
+	assert.Equal(t, int64(5), summary.Dirs)
+	assert.Equal(t, 2, summary.Groups)
+	assert.Equal(t, 4, summary.Duplicates)
+	assert.Equal(t, int64(4*28), summary.ReclaimableBytes)
+	assert.Equal(t, []GroupSummary{{Key: "8206c4027f8a63c28c16353c2b2ec9470e945506a9ba7209f0ae383936b0b242", Files: 3, WastedBytes: 56}},
+		summary.TopGroups)
+	assert.Equal(t, []DirSummary{{Dir: "tmp/B", Files: 2, Bytes: 56}}, summary.TopDirs)
+
+	assert.Equal(t, "0 B", FormatBytes(0))
+	assert.Equal(t, "1023 B", FormatBytes(1023))
+	assert.Equal(t, "1.5 KiB", FormatBytes(1536))
+	assert.Equal(t, "2.0 GiB", FormatBytes(2<<30))
+}
+
+func TestReview(t *testing.T) {
+	fs := NewFileSystemMock(FileSystemTree)
+	fs.fileSystem = make(FileSystemStruct, len(FileSystemTree))
+	for dir, files := range FileSystemTree {
+		fs.fileSystem[dir] = make(map[string]FileInfoMock, len(files))
+		for name, file := range files {
+			fs.fileSystem[dir][name] = file
+		}
+	}
+
+	finder := NewDuplicateFinder(fs, zap.NewNop(), WithMatch(MatchContent))
+	_ = finder.Seek("tmp", 0)
+	report := finder.Report()
+	require.Len(t, report.Groups, 2)
+	copy1, copy2 := report.Groups[0], report.Groups[1]
+
+	review := ReviewByPolicy(copy1, KeepLexical{})
+	assert.Equal(t, "tmp/A/AA/copy1.txt", review.Kept[0].Path)
+	assert.Len(t, review.Duplicates, 2)
+	assert.Equal(t, int64(56), review.WastedBytes())
+
+	_, err := NewReview(copy2, nil)
+	assert.True(t, errors.Is(err, ErrNothingKept))
+	_, err = NewReview(copy2, []int{3})
+	assert.True(t, errors.Is(err, ErrFileNotInGroup))
+
+	review, err = NewReview(copy2, []int{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, []File{copy2.Files[1], copy2.Files[2]}, review.Kept)
+	assert.Equal(t, []File{copy2.Files[0]}, review.Duplicates)
+
+	_, err = finder.ApplyReviewedContext(context.Background(), RemoveAction{}, map[string]Review{"unknown": review})
+	assert.True(t, errors.Is(err, ErrUnknownGroup))
+	_, err = finder.ApplyReviewedContext(context.Background(), RemoveAction{}, map[string]Review{copy1.Key: review})
+	assert.True(t, errors.Is(err, ErrFileNotInGroup))
+
+	result, err := finder.ApplyReviewedContext(context.Background(), RemoveAction{}, map[string]Review{copy2.Key: review})
+	require.NoError(t, err)
+	assert.Equal(t, []File{copy2.Files[0]}, result.Removed)
+	assert.NotContains(t, fs.fileSystem["tmp"], "copy2.txt")
+	assert.Contains(t, fs.fileSystem["tmp/A"], "copy1.txt")
+}
+
+func TestPlan(t *testing.T) {
+	tree := FileSystemStruct{
+		"p": {
+			"a.txt": {name: "a.txt", content: "aaaa"},
+			"b.txt": {name: "b.txt", content: "bbbb"},
+			"c.txt": {name: "c.txt", content: "cccc"},
+			"sub":   {name: "sub", isDir: true},
+		},
+		"p/sub": {
+			"a.txt": {name: "a.txt", content: "aaaa"},
+			"b.txt": {name: "b.txt", content: "bbbb"},
+			"c.txt": {name: "c.txt", content: "dddd"},
+		},
+	}
+	fs := NewFileSystemMock(tree)
+	finder := NewDuplicateFinder(fs, zap.NewNop())
+	_ = finder.Seek("p", 0)
+
+	plan, err := finder.PlanContext(context.Background(), RemoveAction{}, []string{"p"}, "")
+	require.NoError(t, err)
+	require.Len(t, plan.Groups, 2)
+	assert.Equal(t, int64(8), plan.ReclaimableBytes)
+	assert.Equal(t, "p/a.txt", plan.Groups[0].Kept[0].Path)
+	assert.Equal(t, "p/sub/a.txt", plan.Groups[0].Duplicates[0].Path)
+	assert.NotEmpty(t, plan.Groups[0].Duplicates[0].Hash)
+
+	out := new(bytes.Buffer)
+	require.NoError(t, plan.Write(out))
+	read, err := ReadPlan(out)
+	require.NoError(t, err)
+	assert.Equal(t, plan.Groups, read.Groups)
+
+	edited := *read
+	edited.Groups = []PlanGroup{{Key: "a", Kept: read.Groups[0].Kept, Duplicates: read.Groups[1].Duplicates}}
+	errs := finder.ValidatePlanContext(context.Background(), &edited)
+	if assert.Len(t, errs, 1) {
+		assert.True(t, errors.Is(errs[0], ErrPlanMismatch))
+	}
+	result, err := finder.ApplyPlanContext(context.Background(), &edited, RemoveAction{})
+	assert.True(t, errors.Is(err, ErrPlanMismatch))
+	assert.Empty(t, result.Removed)
+	assert.Contains(t, tree["p/sub"], "b.txt")
+
+	_, err = ReadPlan(strings.NewReader(`{"version": 100}`))
+	assert.True(t, errors.Is(err, ErrPlanVersion))
+
+	applier := NewDuplicateFinder(fs, zap.NewNop())
+	_, err = applier.ApplyPlanContext(context.Background(), read, HardlinkAction{})
+	assert.True(t, errors.Is(err, ErrPlanAction))
+
+	tree["p/sub"]["b.txt"] = FileInfoMock{name: "b.txt", content: "cccc"}
+	result, err = applier.ApplyPlanContext(context.Background(), read, RemoveAction{})
+	assert.True(t, errors.Is(err, ErrPlanMismatch))
+	if assert.Len(t, result.Errors, 1) {
+		assert.Equal(t, "p/sub/b.txt", result.Errors[0].Path)
+	}
+	assert.Empty(t, result.Removed)
+	assert.Contains(t, tree["p/sub"], "a.txt")
+
+	tree["p/sub"]["b.txt"] = FileInfoMock{name: "b.txt", content: "bbbb"}
+	result, err = applier.ApplyPlanContext(context.Background(), read, RemoveAction{})
+	require.NoError(t, err)
+	assert.Len(t, result.Removed, 2)
+	assert.Len(t, tree["p/sub"], 1)
+	assert.Contains(t, tree["p/sub"], "c.txt")
+}
+
+func TestDirs(t *testing.T) {
+	tree := FileSystemStruct{
+		"d": {
+			"a": {name: "a", isDir: true},
+			"b": {name: "b", isDir: true},
+			"c": {name: "c", isDir: true},
+			"u": {name: "u", isDir: true},
+		},
+		"d/a":   {"x.txt": {name: "x.txt", content: "xxxx"}, "s": {name: "s", isDir: true}},
+		"d/a/s": {"y.txt": {name: "y.txt", content: "yy"}},
+		"d/b":   {"x.txt": {name: "x.txt", content: "xxxx"}, "s": {name: "s", isDir: true}},
+		"d/b/s": {"y.txt": {name: "y.txt", content: "yy"}},
+		"d/c":   {"x.txt": {name: "x.txt", content: "xxxx"}},
+		"d/u":   {"x.txt": {name: "x.txt", content: "xxxx"}, "z.txt": {name: "z.txt", content: "z"}},
+	}
+	fs := NewFileSystemMock(tree)
+	finder := NewDuplicateFinder(fs, zap.NewNop(), WithDirs(true))
+	result := finder.Seek("d", 0)
+
+	assert.Equal(t, []DirGroup{{Hash: result.Dirs[0].Hash, Dirs: []string{"d/a", "d/b"}, Files: 2, Bytes: 6}}, result.Dirs)
+	assert.Equal(t, []DirSubset{{Dir: "d/c", Superset: "d/a", Files: 1, Bytes: 4}}, result.Subsets)
+	assert.Equal(t, int64(6), result.Dirs[0].WastedBytes())
+
+	out := new(bytes.Buffer)
+	require.NoError(t, finder.WriteDuplicates(out, JSONFormatter{}))
+	assert.Contains(t, out.String(), `"superset": "d/a"`)
+
+	tree["d/b"]["new.txt"] = FileInfoMock{name: "new.txt", content: "new"}
+	removed := finder.RemoveDirsContext(context.Background())
+	assert.Empty(t, removed.Errors)
+	if assert.Len(t, removed.Skipped, 1) {
+		assert.Equal(t, "d/b", removed.Skipped[0].File.Path)
+		assert.True(t, errors.Is(removed.Skipped[0].Reason, ErrDirChanged))
+	}
+	if assert.Len(t, removed.Removed, 1) {
+		assert.Equal(t, "d/c", removed.Removed[0].Path)
+	}
+	assert.NotContains(t, tree, "d/c")
+	assert.NotContains(t, tree["d"], "c")
+
+	delete(tree["d/b"], "new.txt")
+	finder = NewDuplicateFinder(fs, zap.NewNop(), WithDirs(true), WithVerify(true))
+	_ = finder.Seek("d", 0)
+	removed = finder.RemoveDirsContext(context.Background())
+	assert.Empty(t, removed.Errors)
+	assert.Empty(t, removed.Skipped)
+	if assert.Len(t, removed.Removed, 1) {
+		assert.Equal(t, "d/b", removed.Removed[0].Path)
+	}
+	assert.NotContains(t, tree, "d/b/s")
+	assert.NotContains(t, tree["d"], "b")
+	assert.Contains(t, tree["d/a/s"], "y.txt")
+	assert.Contains(t, tree["d/u"], "x.txt")
+}
+
+// failingRemoveFS мок файловой системы, в которой нельзя удалить файлы с именем name
+type failingRemoveFS struct {
+	*FileSystemMock
+	name string
+}
+
+func (f failingRemoveFS) Remove(path string) error {
+	if filepath.Base(path) == f.name {
+		return fmt.Errorf("remove %s: %w", path, ErrMockPermission)
+	}
+
+	return f.FileSystemMock.Remove(path)
+}
+
+func TestDirsRemoveFailure(t *testing.T) {
+	tree := FileSystemStruct{
+		"d": {
+			"a": {name: "a", isDir: true},
+			"b": {name: "b", isDir: true},
+		},
+		"d/a":   {"x.txt": {name: "x.txt", content: "xxxx"}, "s": {name: "s", isDir: true}},
+		"d/a/s": {"y.txt": {name: "y.txt", content: "yy"}},
+		"d/b":   {"x.txt": {name: "x.txt", content: "xxxx"}, "s": {name: "s", isDir: true}},
+		"d/b/s": {"y.txt": {name: "y.txt", content: "yy"}},
+	}
+	finder := NewDuplicateFinder(failingRemoveFS{NewFileSystemMock(tree), "y.txt"}, zap.NewNop(), WithDirs(true))
+	_ = finder.Seek("d", 0)
+
+	removed := finder.RemoveDirsContext(context.Background())
+	assert.Empty(t, removed.Removed)
+	removing := filepath.Join("d", fmt.Sprintf(".b.removing-%d", os.Getpid()))
+	if assert.Len(t, removed.Errors, 1) {
+		assert.Equal(t, filepath.Join(removing, "s", "y.txt"), removed.Errors[0].Path)
+		assert.True(t, errors.Is(removed.Errors[0], os.ErrPermission))
+	}
+
+	assert.NotContains(t, tree["d"], "b")
+	assert.NotContains(t, tree, "d/b")
+	assert.Contains(t, tree[filepath.Join(removing, "s")], "y.txt")
+	assert.Contains(t, tree["d/a/s"], "y.txt")
+}
+
+func TestDirsNameMatch(t *testing.T) {
+	tree := FileSystemStruct{
+		"d": {
+			"a": {name: "a", isDir: true},
+			"b": {name: "b", isDir: true},
+		},
+		"d/a": {"x.txt": {name: "x.txt", content: "xxxx"}},
+		"d/b": {"x.txt": {name: "x.txt", content: "yyyy"}},
+	}
+	finder := NewDuplicateFinder(NewFileSystemMock(tree), zap.NewNop(), WithDirs(true))
+	result := finder.Seek("d", 0)
+	require.Len(t, result.Dirs, 1)
+
+	removed := finder.RemoveDirsContext(context.Background())
+	assert.Empty(t, removed.Removed)
+	assert.Empty(t, removed.Errors)
+	if assert.Len(t, removed.Skipped, 1) {
+		assert.True(t, errors.Is(removed.Skipped[0].Reason, ErrContentMismatch))
+	}
+	assert.Contains(t, tree["d/b"], "x.txt")
+	assert.Contains(t, tree["d"], "b")
+}
+
+func TestCompare(t *testing.T) {
+	tree := FileSystemStruct{
+		"src": {
+			"a.txt":  {name: "a.txt", content: "aaaa"},
+			"b.txt":  {name: "b.txt", content: "bbbb"},
+			"u.txt":  {name: "u.txt", content: "uuuu"},
+			"link":   {name: "link", content: "llll", inode: 7, nlink: 2},
+			"twin-1": {name: "twin-1", content: "tttt"},
+			"twin-2": {name: "twin-2", content: "tttt"},
+		},
+		"ref": {
+			"renamed.txt": {name: "renamed.txt", content: "aaaa"},
+			"sub":         {name: "sub", isDir: true},
+			"l":           {name: "l", content: "llll", inode: 7, nlink: 2},
+		},
+		"ref/sub": {
+			"b.txt": {name: "b.txt", content: "bbbb"},
+		},
+	}
+	fs := NewFileSystemMock(tree)
+	finder := NewDuplicateFinder(fs, zap.NewNop())
+
+	_, err := finder.CompareContext(context.Background(), "src", "src/sub", 0)
+	assert.True(t, errors.Is(err, ErrRootsOverlap))
+
+	comparison, err := finder.CompareContext(context.Background(), "src", "ref", 0)
+	require.NoError(t, err)
+	require.Len(t, comparison.Matched, 3)
+	assert.Equal(t, "src/a.txt", comparison.Matched[0].File.Path)
+	assert.Equal(t, "ref/renamed.txt", comparison.Matched[0].Reference.Path)
+	assert.Equal(t, "ref/sub/b.txt", comparison.Matched[1].Reference.Path)
+	assert.Equal(t, "ref/l", comparison.Matched[2].Reference.Path)
+	assert.Equal(t, int64(12), comparison.MatchedBytes())
+
+	unique := make([]string, len(comparison.Unique))
+	for ind, file := range comparison.Unique {
+		unique[ind] = file.Path
+	}
+	assert.Equal(t, []string{"src/twin-1", "src/twin-2", "src/u.txt"}, unique)
+
+	out := new(bytes.Buffer)
+	require.NoError(t, comparison.WriteJSON(out))
+	assert.Contains(t, out.String(), `"reference": "ref/renamed.txt"`)
+
+	removed := finder.RemoveMatchedContext(context.Background(), comparison)
+	assert.Empty(t, removed.Errors)
+	assert.Len(t, removed.Removed, 3)
+	assert.Len(t, tree["src"], 3)
+	assert.Len(t, tree["ref"], 3)
+	assert.Contains(t, tree["ref/sub"], "b.txt")
+}
+
+func TestCompareSymlinks(t *testing.T) {
+	tree := FileSystemStruct{
+		".": {
+			"alias": {name: "alias", mode: os.ModeSymlink, target: "ref", inode: 5},
+		},
+		"src": {
+			"a.txt": {name: "a.txt", content: "aaaa", inode: 1},
+			"back":  {name: "back", mode: os.ModeSymlink, target: "../ref/b.txt", inode: 3},
+		},
+		"ref": {
+			"link":  {name: "link", mode: os.ModeSymlink, target: "../src/a.txt", inode: 2},
+			"b.txt": {name: "b.txt", content: "bbbb", inode: 4},
+		},
+	}
+	finder := NewDuplicateFinder(NewFileSystemMock(tree), zap.NewNop(), WithFollowSymlinks(true))
+
+	_, err := finder.CompareContext(context.Background(), "alias", "ref", 0)
+	assert.True(t, errors.Is(err, ErrRootsOverlap))
+
+	comparison, err := finder.CompareContext(context.Background(), "src", "ref", 0)
+	require.NoError(t, err)
+	assert.Empty(t, comparison.Errors)
+	assert.Empty(t, comparison.Matched)
+	if assert.Len(t, comparison.Unique, 1) {
+		assert.Equal(t, "src/a.txt", comparison.Unique[0].Path)
+	}
+
+	removed := finder.RemoveMatchedContext(context.Background(), comparison)
+	assert.Empty(t, removed.Removed)
+	assert.Contains(t, tree["src"], "a.txt")
+	assert.Contains(t, tree["ref"], "b.txt")
+}
+
+// crossDeviceFS мок файловой системы, в которой жесткую ссылку создать нельзя: файлы на разных устройствах
+type crossDeviceFS struct {
+	*FileSystemMock
+}
+
+func (f crossDeviceFS) Link(oldname, newname string) error {
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EXDEV}
+}
+
+func TestHardlinkCrossDevice(t *testing.T) {
+	tree := FileSystemStruct{
+		"d": {
+			"a.txt": {name: "a.txt", content: "aaaa"},
+			"b.txt": {name: "b.txt", content: "aaaa"},
+		},
+	}
+	fs := crossDeviceFS{NewFileSystemMock(tree)}
+
+	_, err := HardlinkAction{}.Apply(fs, File{Path: "d/a.txt"}, File{Path: "d/b.txt"})
+	assert.True(t, errors.Is(err, ErrCrossDevice))
+	assert.True(t, errors.Is(err, syscall.EXDEV))
+
+	var linkErr *os.LinkError
+	if assert.True(t, errors.As(err, &linkErr)) {
+		assert.Equal(t, "d/a.txt", linkErr.Old)
+	}
+	assert.Contains(t, tree["d"], "b.txt")
+}
+
+// racingQuarantineFS мок файловой системы, в которой параллельный запуск занимает путь в карантине
+// непосредственно перед созданием файла
+type racingQuarantineFS struct {
+	*FileSystemMock
+	claimed bool
+}
+
+func (f *racingQuarantineFS) Create(path string, perm os.FileMode) (io.WriteCloser, error) {
+	if !f.claimed {
+		f.claimed = true
+		f.fileSystem[filepath.Dir(path)][filepath.Base(path)] = FileInfoMock{name: filepath.Base(path), content: "other run"}
+	}
+
+	return f.FileSystemMock.Create(path, perm)
+}
+
+func TestQuarantineClaimsFreeTarget(t *testing.T) {
+	tree := FileSystemStruct{
+		"d": {
+			"a.txt": {name: "a.txt", content: "aaaa"},
+			"b.txt": {name: "b.txt", content: "aaaa"},
+		},
+	}
+	fs := &racingQuarantineFS{FileSystemMock: NewFileSystemMock(tree)}
+
+	target, err := QuarantineAction{Dir: "trash"}.Apply(fs, File{Path: "d/a.txt"}, File{Path: "d/b.txt"})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("trash", "files", "d", "b.txt.1"), target)
+	assert.Equal(t, "other run", tree["trash/files/d"]["b.txt"].content)
+	assert.Equal(t, "aaaa", tree["trash/files/d"]["b.txt.1"].content)
+	assert.NotContains(t, tree["d"], "b.txt")
+}
+
+// crossDeviceRenameFS мок файловой системы, в которой файл нельзя переименовать: директории на разных устройствах
+type crossDeviceRenameFS struct {
+	*FileSystemMock
+}
+
+func (f crossDeviceRenameFS) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+}
+
+func TestQuarantineCrossDevice(t *testing.T) {
+	tree := FileSystemStruct{
+		"d": {
+			"a.txt": {name: "a.txt", content: "aaaa"},
+			"b.txt": {name: "b.txt", content: "aaaa"},
+		},
+	}
+	fs := crossDeviceRenameFS{NewFileSystemMock(tree)}
+
+	_, err := QuarantineAction{Dir: "trash"}.Apply(fs, File{Path: "d/a.txt"}, File{Path: "d/b.txt"})
+	assert.True(t, errors.Is(err, ErrCrossDevice))
+	assert.True(t, errors.Is(err, syscall.EXDEV))
+	assert.Contains(t, tree["d"], "b.txt")
+	assert.Empty(t, tree["trash/files/d"])
+}
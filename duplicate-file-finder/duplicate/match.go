@@ -0,0 +1,42 @@
+package duplicate
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownMatchMode Ошибка разбора неизвестного способа сравнения файлов
+var ErrUnknownMatchMode = errors.New("unknown match mode")
+
+// MatchMode описывает способ, которым файлы объединяются в группы дубликатов
+type MatchMode int
+
+const (
+	// MatchName файлы считаются дубликатами при совпадении имени и размера
+	MatchName MatchMode = iota
+	// MatchContent файлы считаются дубликатами при совпадении SHA-256 содержимого
+	MatchContent
+)
+
+// String возвращает имя способа сравнения, используемое во флаге --match
+func (m MatchMode) String() string {
+	switch m {
+	case MatchName:
+		return "name"
+	case MatchContent:
+		return "content"
+	}
+
+	return fmt.Sprintf("MatchMode(%d)", int(m))
+}
+
+// ParseMatchMode разбирает имя способа сравнения
+func ParseMatchMode(name string) (MatchMode, error) {
+	for _, mode := range []MatchMode{MatchName, MatchContent} {
+		if mode.String() == name {
+			return mode, nil
+		}
+	}
+
+	return MatchName, fmt.Errorf("%q: %w", name, ErrUnknownMatchMode)
+}
@@ -1,15 +1,48 @@
 package duplicate
 
 import (
-	"errors"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
+// mockError ошибка мока файловой системы, которая, как и ошибки os, соответствует target в errors.Is
+type mockError struct {
+	message string
+	target  error
+}
+
+func (e mockError) Error() string {
+	return e.message
+}
+
+// Is сопоставляет ошибку мока с ошибкой os
+func (e mockError) Is(target error) bool {
+	return target == e.target
+}
+
 // ErrMockNotFileExist Ошибка для мока файловой системы, обозначающая несуществующую директорию или файл
-var ErrMockNotFileExist = errors.New("no such file or directory")
+var ErrMockNotFileExist error = mockError{message: "no such file or directory", target: os.ErrNotExist}
+
+// ErrMockFileExist Ошибка для мока файловой системы, обозначающая что файл уже существует
+var ErrMockFileExist error = mockError{message: "file exists", target: os.ErrExist}
+
+// ErrMockPermission Ошибка для мока файловой системы, обозначающая отсутствие прав доступа
+var ErrMockPermission error = mockError{message: "permission denied", target: os.ErrPermission}
+
+// ErrMockNotEmpty Ошибка для мока файловой системы, обозначающая удаление непустой директории
+var ErrMockNotEmpty error = mockError{message: "directory not empty"}
+
+// ErrMockLoop Ошибка для мока файловой системы, обозначающая зацикленные символические ссылки
+var ErrMockLoop error = mockError{message: "too many levels of symbolic links"}
+
+// maxMockSymlinks максимальное количество символических ссылок, которые раскрываются в одном пути
+const maxMockSymlinks = 40
 
 // FileSystemStruct описывает структуру мока файловой системы
 type FileSystemStruct map[string]map[string]FileInfoMock
@@ -17,30 +50,32 @@ type FileSystemStruct map[string]map[string]FileInfoMock
 // FileSystemTree описывает содержимое мока файловой системы
 var FileSystemTree = FileSystemStruct{
 	"tmp": {
-		"unique.txt": {name: "unique.txt", content: "Unique content for ./unique.txt"},
-		"copy1.txt":  {name: "copy1.txt", content: "Some content for ./copy1.txt"},
-		"copy2.txt":  {name: "copy2.txt", content: "Some content for ./copy2.txt"},
+		"unique.txt": {name: "unique.txt", content: "Unique content for ./unique.txt", modeTime: TestModTime},
+		"copy1.txt":  {name: "copy1.txt", content: "Some content for ./copy1.txt", modeTime: TestModTime},
+		"copy2.txt":  {name: "copy2.txt", content: "Some content for ./copy2.txt", modeTime: TestModTime},
 		"A":          {name: "A", isDir: true},
 		"B":          {name: "B", isDir: true},
 	},
 	"tmp/A": {
-		"copy1.txt": {name: "copy1.txt", content: "Some content for ./copy1.txt"},
+		"copy1.txt": {name: "copy1.txt", content: "Some content for ./copy1.txt", modeTime: TestModTime},
 		"AA":        {name: "AA", isDir: true},
 		"AB":        {name: "AB", isDir: true},
 	},
 	"tmp/B": {
-		"copy2.txt": {name: "copy2.txt", content: "Some content for ./copy2.txt"},
+		"copy2.txt":   {name: "copy2.txt", content: "Some content for ./copy2.txt", modeTime: TestModTime},
+		"renamed.txt": {name: "renamed.txt", content: "Some content for ./copy2.txt", modeTime: TestModTime},
 	},
 	"tmp/A/AA": {
-		"copy1.txt": {name: "copy1.txt", content: "Some content for ./copy1.txt"},
+		"copy1.txt": {name: "copy1.txt", content: "Some content for ./copy1.txt", modeTime: TestModTime},
 	},
 	"tmp/A/AB": {
-		"copy1.txt": {name: "copy1.txt", content: "Some other content for ./copy1.txt"},
+		"copy1.txt": {name: "copy1.txt", content: "Some other content for ./copy1.txt", modeTime: TestModTime},
 	},
 }
 
 // FileSystemMock описывает мок файловой системы
 type FileSystemMock struct {
+	sync.RWMutex
 	fileSystem FileSystemStruct
 }
 
@@ -51,8 +86,20 @@ func NewFileSystemMock(fileSystem FileSystemStruct) *FileSystemMock {
 	}
 }
 
-// ReadDir читает содержимое директории в FileSystemMock
+// ReadDir читает содержимое директории в FileSystemMock, переходя по символическим ссылкам в пути
 func (dr *FileSystemMock) ReadDir(path string) ([]os.FileInfo, error) {
+	dr.RLock()
+	defer dr.RUnlock()
+
+	path, err := dr.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if dr.fileSystem[filepath.Dir(path)][filepath.Base(path)].denied {
+		return nil, fmt.Errorf("open %s: %w", path, ErrMockPermission)
+	}
+
 	if fileInfos, ok := dr.fileSystem[path]; ok {
 		files := make([]os.FileInfo, len(fileInfos))
 
@@ -68,22 +115,320 @@ func (dr *FileSystemMock) ReadDir(path string) ([]os.FileInfo, error) {
 	return nil, fmt.Errorf("open %s: %w", path, ErrMockNotFileExist)
 }
 
-// Remove удаляет файл из FileSystemMock
+// Lstat возвращает информацию о файле или директории FileSystemMock
+func (dr *FileSystemMock) Lstat(path string) (os.FileInfo, error) {
+	dr.RLock()
+	defer dr.RUnlock()
+
+	if file, ok := dr.lstat(path); ok {
+		return file, nil
+	}
+
+	return nil, fmt.Errorf("lstat %s: %w", path, ErrMockNotFileExist)
+}
+
+// Stat возвращает информацию о файле или директории FileSystemMock, переходя по символическим ссылкам
+func (dr *FileSystemMock) Stat(path string) (os.FileInfo, error) {
+	dr.RLock()
+	defer dr.RUnlock()
+
+	resolved, err := dr.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, ok := dr.lstat(resolved)
+	if !ok {
+		return nil, fmt.Errorf("stat %s: %w", path, ErrMockNotFileExist)
+	}
+	file.name = filepath.Base(path)
+
+	return file, nil
+}
+
+// lstat ищет файл или директорию FileSystemMock, не переходя по символической ссылке
+func (dr *FileSystemMock) lstat(path string) (FileInfoMock, bool) {
+	path = filepath.Clean(path)
+	if file, ok := dr.fileSystem[filepath.Dir(path)][filepath.Base(path)]; ok {
+		return file, true
+	}
+
+	if _, ok := dr.fileSystem[path]; ok {
+		return FileInfoMock{name: filepath.Base(path), isDir: true}, true
+	}
+
+	return FileInfoMock{}, false
+}
+
+// resolve раскрывает символические ссылки в пути, как это делает файловая система при открытии файла.
+// Относительная цель ссылки отсчитывается от директории ссылки.
+func (dr *FileSystemMock) resolve(path string) (string, error) {
+	separator := string(filepath.Separator)
+	components := strings.Split(filepath.Clean(path), separator)
+	resolved := components[0]
+
+	hops := 0
+	for i := 1; i < len(components); i++ {
+		file, ok := dr.fileSystem[resolved][components[i]]
+		if !ok || file.mode&os.ModeSymlink == 0 {
+			resolved = filepath.Join(resolved, components[i])
+			continue
+		}
+
+		hops++
+		if hops > maxMockSymlinks {
+			return "", fmt.Errorf("stat %s: %w", path, ErrMockLoop)
+		}
+
+		target := file.target
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(resolved, target)
+		}
+
+		components = append(strings.Split(filepath.Clean(target), separator), components[i+1:]...)
+		resolved = components[0]
+		i = 0
+	}
+
+	return resolved, nil
+}
+
+// Readlink возвращает содержимое символической ссылки FileSystemMock
+func (dr *FileSystemMock) Readlink(path string) (string, error) {
+	dr.RLock()
+	defer dr.RUnlock()
+
+	file, ok := dr.fileSystem[filepath.Dir(path)][filepath.Base(path)]
+	if !ok || file.mode&os.ModeSymlink == 0 {
+		return "", fmt.Errorf("readlink %s: %w", path, ErrMockNotFileExist)
+	}
+
+	return file.target, nil
+}
+
+// Open открывает файл из FileSystemMock для чтения содержимого, переходя по символическим ссылкам
+func (dr *FileSystemMock) Open(path string) (FileContent, error) {
+	dr.RLock()
+	defer dr.RUnlock()
+
+	path, err := dr.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, ok := dr.fileSystem[filepath.Dir(path)][filepath.Base(path)]
+	if !ok || file.isDir {
+		return nil, fmt.Errorf("open %s: %w", path, ErrMockNotFileExist)
+	}
+
+	if file.denied {
+		return nil, fmt.Errorf("open %s: %w", path, ErrMockPermission)
+	}
+
+	return fileContentMock{strings.NewReader(file.content)}, nil
+}
+
+// fileContentMock описывает открытый файл FileSystemMock
+type fileContentMock struct {
+	*strings.Reader
+}
+
+// Close закрывает файл FileSystemMock
+func (f fileContentMock) Close() error {
+	return nil
+}
+
+// Remove удаляет файл или пустую директорию из FileSystemMock
 func (dr *FileSystemMock) Remove(path string) error {
+	dr.Lock()
+	defer dr.Unlock()
+
 	dir := filepath.Dir(path)
 	if _, ok := dr.fileSystem[dir]; !ok {
 		return fmt.Errorf("open %s: %w", path, ErrMockNotFileExist)
 	}
 
 	filename := filepath.Base(path)
-	if _, ok := dr.fileSystem[dir][filename]; !ok {
+	file, ok := dr.fileSystem[dir][filename]
+	if !ok {
 		return fmt.Errorf("stat %s: %w", path, ErrMockNotFileExist)
 	}
 
+	if file.denied {
+		return fmt.Errorf("remove %s: %w", path, ErrMockPermission)
+	}
+
+	if file.isDir {
+		if len(dr.fileSystem[path]) > 0 {
+			return fmt.Errorf("remove %s: %w", path, ErrMockNotEmpty)
+		}
+		delete(dr.fileSystem, path)
+	}
+
 	delete(dr.fileSystem[dir], filename)
 	return nil
 }
 
+// Link создает в FileSystemMock жесткую ссылку newname на файл oldname
+func (dr *FileSystemMock) Link(oldname, newname string) error {
+	dr.Lock()
+	defer dr.Unlock()
+
+	file, ok := dr.fileSystem[filepath.Dir(oldname)][filepath.Base(oldname)]
+	if !ok || file.isDir {
+		return fmt.Errorf("link %s: %w", oldname, ErrMockNotFileExist)
+	}
+
+	return dr.create(newname, file)
+}
+
+// Symlink создает в FileSystemMock символическую ссылку newname на oldname
+func (dr *FileSystemMock) Symlink(oldname, newname string) error {
+	dr.Lock()
+	defer dr.Unlock()
+
+	return dr.create(newname, FileInfoMock{mode: os.ModeSymlink, target: oldname})
+}
+
+// Reflink создает в FileSystemMock копию src с именем dst
+func (dr *FileSystemMock) Reflink(src, dst string) error {
+	return dr.Link(src, dst)
+}
+
+// MkdirAll создает в FileSystemMock директорию вместе со всеми родительскими директориями
+func (dr *FileSystemMock) MkdirAll(path string, perm os.FileMode) error {
+	dr.Lock()
+	defer dr.Unlock()
+
+	path = filepath.Clean(path)
+	for dir := path; dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if _, ok := dr.fileSystem[dir]; !ok {
+			dr.fileSystem[dir] = make(map[string]FileInfoMock)
+		}
+
+		parent, name := filepath.Dir(dir), filepath.Base(dir)
+		if _, ok := dr.fileSystem[parent]; ok {
+			dr.fileSystem[parent][name] = FileInfoMock{name: name, mode: os.ModeDir | perm, isDir: true}
+		}
+	}
+
+	return nil
+}
+
+// Create создает в FileSystemMock новый файл, содержимое которого записывается при закрытии
+func (dr *FileSystemMock) Create(path string, perm os.FileMode) (io.WriteCloser, error) {
+	dr.Lock()
+	defer dr.Unlock()
+
+	if err := dr.create(path, FileInfoMock{mode: perm}); err != nil {
+		return nil, err
+	}
+
+	return &fileWriterMock{fs: dr, path: path}, nil
+}
+
+// Chtimes изменяет время изменения файла FileSystemMock
+func (dr *FileSystemMock) Chtimes(path string, atime, mtime time.Time) error {
+	dr.Lock()
+	defer dr.Unlock()
+
+	dir, filename := filepath.Dir(path), filepath.Base(path)
+	file, ok := dr.fileSystem[dir][filename]
+	if !ok {
+		return fmt.Errorf("chtimes %s: %w", path, ErrMockNotFileExist)
+	}
+
+	file.modeTime = mtime
+	dr.fileSystem[dir][filename] = file
+	return nil
+}
+
+// fileWriterMock описывает открытый для записи файл FileSystemMock
+type fileWriterMock struct {
+	bytes.Buffer
+	fs   *FileSystemMock
+	path string
+}
+
+// Close сохраняет записанное содержимое в FileSystemMock
+func (f *fileWriterMock) Close() error {
+	f.fs.Lock()
+	defer f.fs.Unlock()
+
+	dir, filename := filepath.Dir(f.path), filepath.Base(f.path)
+	file, ok := f.fs.fileSystem[dir][filename]
+	if !ok {
+		return fmt.Errorf("close %s: %w", f.path, ErrMockNotFileExist)
+	}
+
+	file.content = f.String()
+	f.fs.fileSystem[dir][filename] = file
+	return nil
+}
+
+// create добавляет в FileSystemMock новый файл, если файла с таким путем еще нет
+func (dr *FileSystemMock) create(path string, file FileInfoMock) error {
+	dir := filepath.Dir(path)
+	if _, ok := dr.fileSystem[dir]; !ok {
+		return fmt.Errorf("create %s: %w", path, ErrMockNotFileExist)
+	}
+
+	filename := filepath.Base(path)
+	if _, ok := dr.fileSystem[dir][filename]; ok {
+		return fmt.Errorf("create %s: %w", path, ErrMockFileExist)
+	}
+
+	file.name = filename
+	dr.fileSystem[dir][filename] = file
+	return nil
+}
+
+// Rename переименовывает файл или директорию в FileSystemMock, заменяя существующий файл newpath
+func (dr *FileSystemMock) Rename(oldpath, newpath string) error {
+	dr.Lock()
+	defer dr.Unlock()
+
+	oldDir, oldFilename := filepath.Dir(oldpath), filepath.Base(oldpath)
+	file, ok := dr.fileSystem[oldDir][oldFilename]
+	if !ok {
+		return fmt.Errorf("rename %s: %w", oldpath, ErrMockNotFileExist)
+	}
+
+	newDir, newFilename := filepath.Dir(newpath), filepath.Base(newpath)
+	if _, ok = dr.fileSystem[newDir]; !ok {
+		return fmt.Errorf("rename %s: %w", newpath, ErrMockNotFileExist)
+	}
+
+	if file.isDir {
+		if _, ok = dr.fileSystem[newDir][newFilename]; ok {
+			return fmt.Errorf("rename %s: %w", newpath, ErrMockFileExist)
+		}
+		dr.renameDir(filepath.Clean(oldpath), filepath.Clean(newpath))
+	}
+
+	delete(dr.fileSystem[oldDir], oldFilename)
+	file.name = newFilename
+	dr.fileSystem[newDir][newFilename] = file
+	return nil
+}
+
+// renameDir переносит содержимое директории oldpath со всеми поддиректориями в newpath
+func (dr *FileSystemMock) renameDir(oldpath, newpath string) {
+	prefix := oldpath + string(filepath.Separator)
+	var dirs []string
+	for dir := range dr.fileSystem {
+		if dir == oldpath || strings.HasPrefix(dir, prefix) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, dir := range dirs {
+		files := dr.fileSystem[dir]
+		delete(dr.fileSystem, dir)
+		dr.fileSystem[newpath+dir[len(oldpath):]] = files
+	}
+}
+
 // FileInfoMock описывает мок файла
 type FileInfoMock struct {
 	name     string
@@ -91,6 +436,14 @@ type FileInfoMock struct {
 	modeTime time.Time
 	isDir    bool
 	content  string
+	target   string
+	// denied нет прав на чтение и удаление файла или директории
+	denied bool
+	// inode номер inode файла, 0 - мок не сообщает устройство и inode.
+	// Файлы с одинаковым inode считаются жесткими ссылками на один файл.
+	inode uint64
+	// nlink количество жестких ссылок на файл, 0 - мок его не сообщает
+	nlink uint64
 }
 
 // Name возвращает имя файла
@@ -120,5 +473,19 @@ func (f FileInfoMock) IsDir() bool {
 
 // Sys underlying data source (can return nil)
 func (f FileInfoMock) Sys() interface{} {
-	return nil
+	return f
+}
+
+// FileID возвращает устройство и inode файла мока
+func (f FileInfoMock) FileID() FileID {
+	if f.inode == 0 {
+		return FileID{}
+	}
+
+	return FileID{Device: 1, Inode: f.inode}
+}
+
+// Links возвращает количество жестких ссылок на файл мока
+func (f FileInfoMock) Links() uint64 {
+	return f.nlink
 }
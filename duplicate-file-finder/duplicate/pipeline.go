@@ -0,0 +1,230 @@
+package duplicate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// minGroupSize минимальное количество файлов в группе дубликатов
+const minGroupSize = 2
+
+// partialHashSize размер блока в начале и в конце файла, по которым считается частичный хэш
+const partialHashSize = 4 * 1024
+
+// StageStats описывает объем работы одного этапа поиска
+type StageStats struct {
+	Files int64
+	Bytes int64
+}
+
+// add учитывает прочитанный этапом файл
+func (s *StageStats) add(bytes int64) {
+	atomic.AddInt64(&s.Files, 1)
+	atomic.AddInt64(&s.Bytes, bytes)
+}
+
+// PipelineStats описывает работу этапов поиска дубликатов по содержимому:
+// группировка по размеру, частичный хэш и полный хэш
+type PipelineStats struct {
+	Size    StageStats
+	Partial StageStats
+	Full    StageStats
+}
+
+// Stats возвращает статистику этапов последнего поиска
+func (d *Duplicates) Stats() PipelineStats {
+	return d.stats
+}
+
+// groupFiles группирует найденные файлы выбранным способом сравнения
+func (d *Duplicates) groupFiles(ctx context.Context) {
+	switch d.match {
+	case MatchName:
+		d.files = make(Files)
+		for _, file := range d.scanned {
+			token := fmt.Sprintf("%s_%d", file.Name, file.Size)
+			d.files[token] = append(d.files[token], file)
+		}
+	case MatchContent:
+		d.files = d.groupByContent(ctx)
+	}
+}
+
+// groupByContent группирует файлы по содержимому в три этапа:
+// по размеру, по хэшу начала и конца файла и по хэшу всего файла.
+// На каждый следующий этап попадают только файлы из групп, где больше одного файла.
+func (d *Duplicates) groupByContent(ctx context.Context) Files {
+	bySize := make(Files)
+	for _, file := range d.scanned {
+		token := strconv.FormatInt(file.Size, 10)
+		bySize[token] = append(bySize[token], file)
+		d.stats.Size.add(0)
+	}
+
+	byPartial := d.regroup(ctx, bySize, func(file *File) (string, error) {
+		hash, err := d.partialHash(ctx, file)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%d_%s", file.Size, hash), nil
+	})
+
+	return d.regroup(ctx, byPartial, func(file *File) (string, error) {
+		if file.Hash != "" {
+			return file.Hash, nil
+		}
+
+		hash, err := d.fullHash(ctx, file)
+		if err != nil {
+			return "", err
+		}
+		file.Hash = hash
+
+		return hash, nil
+	})
+}
+
+// regroup перегруппировывает файлы групп-кандидатов по ключу, который возвращает token.
+// Ключи считаются пулом из d.hashJobs воркеров. Файлы, ключ которых не посчитан до отмены ctx, отбрасываются.
+// Для жестких ссылок на один файл ключ считается один раз, группы из одного физического файла пропускаются.
+func (d *Duplicates) regroup(ctx context.Context, groups Files, token func(file *File) (string, error)) Files {
+	result := make(Files)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	candidates := make(chan []File)
+	for i := 0; i < d.hashJobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for links := range candidates {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				file := &links[0]
+				key, err := token(file)
+				if err != nil {
+					if ctx.Err() != nil {
+						continue
+					}
+
+					d.addError(OpHash, file.Path, err)
+					continue
+				}
+
+				for ind := range links[1:] {
+					links[ind+1].Hash = file.Hash
+				}
+
+				mu.Lock()
+				result[key] = append(result[key], links...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, group := range groups {
+		if len(group) < minGroupSize {
+			continue
+		}
+
+		physical := physicalFiles(group)
+		if len(physical) < minGroupSize {
+			continue
+		}
+
+		for _, links := range physical {
+			select {
+			case candidates <- links:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(candidates)
+	wg.Wait()
+
+	return result
+}
+
+// partialHash считает хэш первых и последних partialHashSize байт файла.
+// Если файл целиком помещается в эти блоки, хэш считается по всему файлу и сохраняется в file.Hash.
+func (d *Duplicates) partialHash(ctx context.Context, file *File) (string, error) {
+	if file.Size <= 2*partialHashSize {
+		hash, err := d.cachedHash(file, partialField, func() (string, error) {
+			return d.hashContent(ctx, file, &d.stats.Partial, func(content FileContent) io.Reader {
+				return content
+			})
+		})
+		if err != nil {
+			return "", err
+		}
+		file.Hash = hash
+
+		return hash, nil
+	}
+
+	return d.cachedHash(file, partialField, func() (string, error) {
+		return d.hashContent(ctx, file, &d.stats.Partial, func(content FileContent) io.Reader {
+			return io.MultiReader(
+				io.NewSectionReader(content, 0, partialHashSize),
+				io.NewSectionReader(content, file.Size-partialHashSize, partialHashSize),
+			)
+		})
+	})
+}
+
+// fullHash считает хэш всего содержимого файла
+func (d *Duplicates) fullHash(ctx context.Context, file *File) (string, error) {
+	return d.cachedHash(file, fullField, func() (string, error) {
+		return d.hashContent(ctx, file, &d.stats.Full, func(content FileContent) io.Reader {
+			return content
+		})
+	})
+}
+
+// hashContent считает SHA-256 данных файла, которые выбирает reader, и учитывает прочитанное в stats.
+// Чтение прерывается при отмене ctx.
+func (d *Duplicates) hashContent(ctx context.Context, file *File, stats *StageStats, reader func(FileContent) io.Reader) (string, error) {
+	content, err := d.fs.Open(file.Path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, contextReader{ctx: ctx, reader: reader(content)})
+	stats.add(n)
+	atomic.AddInt64(&d.progress.hashedBytes, n)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// contextReader прерывает чтение после отмены контекста
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.reader.Read(p)
+}
@@ -0,0 +1,318 @@
+package duplicate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrPlanMismatch Ошибка, обозначающая что файл изменился после записи в план
+var ErrPlanMismatch = errors.New("file does not match plan")
+
+// ErrPlanVersion Ошибка чтения плана неподдерживаемой версии
+var ErrPlanVersion = errors.New("unsupported plan version")
+
+// ErrPlanAction Ошибка выполнения плана действием, отличным от записанного в плане
+var ErrPlanAction = errors.New("action differs from plan")
+
+// PlanVersion версия формата файла плана
+const PlanVersion = 1
+
+// OpValidate операция сверки файла с планом, при которой возникают ошибки PathError
+const OpValidate = "validate"
+
+// Fingerprint описывает ожидаемое состояние файла: размер, время изменения и SHA-256 содержимого.
+// Для файла, найденного по символической ссылке, это состояние файла, на который она указывает.
+type Fingerprint struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"hash"`
+	Symlink bool      `json:"symlink,omitempty"`
+}
+
+// PlanGroup описывает группу дубликатов в плане: какие файлы остаются, а над какими выполняется действие.
+// Первый из оставляемых файлов используется действием как оригинал.
+type PlanGroup struct {
+	Key        string        `json:"key"`
+	Kept       []Fingerprint `json:"kept"`
+	Duplicates []Fingerprint `json:"duplicates"`
+}
+
+// Plan описывает сохраненный план обработки дубликатов.
+// Относительные пути отсчитываются от WorkDir, если он задан.
+type Plan struct {
+	Version          int         `json:"version"`
+	Created          time.Time   `json:"created"`
+	WorkDir          string      `json:"workDir,omitempty"`
+	Roots            []string    `json:"roots,omitempty"`
+	Match            string      `json:"match"`
+	Action           string      `json:"action"`
+	RelativeSymlinks bool        `json:"relativeSymlinks,omitempty"`
+	ReclaimableBytes int64       `json:"reclaimableBytes"`
+	Groups           []PlanGroup `json:"groups"`
+}
+
+// Path возвращает путь относительно рабочей директории, в которой план был создан
+func (p *Plan) Path(name string) string {
+	if p.WorkDir == "" || filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(p.WorkDir, name)
+}
+
+// ParseAction возвращает действие, записанное в плане
+func (p *Plan) ParseAction() (Action, error) {
+	action, err := ParseAction(p.Action)
+	if err != nil {
+		return nil, err
+	}
+
+	if symlink, ok := action.(SymlinkAction); ok {
+		symlink.Relative = p.RelativeSymlinks
+		action = symlink
+	}
+
+	return action, nil
+}
+
+// Write записывает план в w в формате JSON, удобном для просмотра человеком
+func (p *Plan) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(p)
+}
+
+// ReadPlan читает план из r
+func ReadPlan(r io.Reader) (*Plan, error) {
+	var plan Plan
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return nil, err
+	}
+
+	if plan.Version != PlanVersion {
+		return nil, fmt.Errorf("%d: %w", plan.Version, ErrPlanVersion)
+	}
+
+	return &plan, nil
+}
+
+// PlanContext создает план обработки найденных дубликатов в стартовых директориях roots действием action,
+// пока не отменен контекст ctx. В группе остается файл, выбранный правилами WithKeepPolicy. Если хэши файлов
+// не посчитаны при поиске, они считаются для плана; группы, хэш файла которых посчитать не удалось, в план не попадают
+// и возвращаются в ошибке. Файлы, содержимое которых отличается от оставляемого файла, в план не попадают.
+// Пути в плане отсчитываются от workDir.
+func (d *Duplicates) PlanContext(ctx context.Context, action Action, roots []string, workDir string) (*Plan, error) {
+	plan := &Plan{
+		Version: PlanVersion,
+		Created: time.Now().UTC(),
+		WorkDir: workDir,
+		Roots:   roots,
+		Match:   d.match.String(),
+		Action:  action.String(),
+	}
+	if symlink, ok := action.(SymlinkAction); ok {
+		plan.RelativeSymlinks = symlink.Relative
+	}
+
+	keys := make([]string, 0, len(d.files))
+	for key := range d.files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs PathErrors
+	for _, key := range keys {
+		files := d.files[key]
+		fingerprints, err := d.fingerprints(ctx, files)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			errs = append(errs, err)
+			continue
+		}
+
+		planned, duplicates := []File{files[0]}, []Fingerprint(nil)
+		for ind, fingerprint := range fingerprints[1:] {
+			if fingerprint.Hash != fingerprints[0].Hash {
+				d.logger.Warn("Skip planning file with different content " + fingerprint.Path)
+				continue
+			}
+			planned = append(planned, files[ind+1])
+			duplicates = append(duplicates, fingerprint)
+		}
+		if len(duplicates) == 0 {
+			continue
+		}
+
+		plan.ReclaimableBytes += Group{Key: key, Files: planned}.WastedBytes()
+		plan.Groups = append(plan.Groups, PlanGroup{Key: key, Kept: fingerprints[:1], Duplicates: duplicates})
+	}
+
+	return plan, errs.Err()
+}
+
+// fingerprints возвращает ожидаемое состояние файлов группы. Если хэш хотя бы одного файла посчитать не удалось,
+// группа не попадает в план.
+func (d *Duplicates) fingerprints(ctx context.Context, files []File) ([]Fingerprint, *PathError) {
+	fingerprints := make([]Fingerprint, len(files))
+	for ind, file := range files {
+		fingerprint, err := d.fingerprint(ctx, file)
+		if err != nil {
+			return nil, d.pathError(OpHash, file.Path, err)
+		}
+		fingerprints[ind] = fingerprint
+	}
+
+	return fingerprints, nil
+}
+
+// fingerprint возвращает ожидаемое состояние найденного файла. Хэш считается, если он не посчитан при поиске.
+func (d *Duplicates) fingerprint(ctx context.Context, file File) (Fingerprint, error) {
+	fingerprint := Fingerprint{
+		Path:    file.Path,
+		Size:    file.Size,
+		ModTime: file.ModTime,
+		Hash:    file.Hash,
+		Symlink: file.Symlink,
+	}
+	if fingerprint.Hash != "" {
+		return fingerprint, nil
+	}
+
+	hash, err := d.fullHash(ctx, &file)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	fingerprint.Hash = hash
+
+	return fingerprint, nil
+}
+
+// ValidatePlanContext сверяет каждый файл плана с записанным состоянием, пока не отменен контекст ctx.
+// Возвращает ошибки файлов, которые исчезли или изменились, и дубликатов, хэш которых в плане отличается
+// от хэша оставляемого файла; они соответствуют ErrPlanMismatch или ErrFileVanished.
+func (d *Duplicates) ValidatePlanContext(ctx context.Context, plan *Plan) PathErrors {
+	var errs PathErrors
+	for _, group := range plan.Groups {
+		for _, fingerprint := range group.Duplicates {
+			if len(group.Kept) == 0 || fingerprint.Hash != group.Kept[0].Hash {
+				err := fmt.Errorf("hash differs from kept file: %w", ErrPlanMismatch)
+				errs = append(errs, d.pathError(OpValidate, plan.Path(fingerprint.Path), err))
+			}
+		}
+
+		fingerprints := append(append([]Fingerprint{}, group.Kept...), group.Duplicates...)
+		for _, fingerprint := range fingerprints {
+			if ctx.Err() != nil {
+				return errs
+			}
+
+			name := plan.Path(fingerprint.Path)
+			if err := d.validateFingerprint(ctx, name, fingerprint); err != nil {
+				errs = append(errs, d.pathError(OpValidate, name, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateFingerprint проверяет, что файл name совпадает с ожидаемым состоянием fingerprint
+func (d *Duplicates) validateFingerprint(ctx context.Context, name string, fingerprint Fingerprint) error {
+	info, err := d.fs.Lstat(name)
+	if err != nil {
+		return err
+	}
+
+	isSymlink := info.Mode()&os.ModeSymlink != 0
+	if isSymlink != fingerprint.Symlink {
+		return fmt.Errorf("symlink %t, want %t: %w", isSymlink, fingerprint.Symlink, ErrPlanMismatch)
+	}
+	if isSymlink {
+		if info, err = d.fs.Stat(name); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case !info.Mode().IsRegular():
+		return fmt.Errorf("not a regular file: %w", ErrPlanMismatch)
+	case info.Size() != fingerprint.Size:
+		return fmt.Errorf("size %d, want %d: %w", info.Size(), fingerprint.Size, ErrPlanMismatch)
+	case !info.ModTime().Equal(fingerprint.ModTime):
+		return fmt.Errorf("mtime %s, want %s: %w", info.ModTime().UTC(), fingerprint.ModTime.UTC(), ErrPlanMismatch)
+	}
+
+	file := File{Path: name, Size: fingerprint.Size}
+	hash, err := d.hashContent(ctx, &file, &d.stats.Full, func(content FileContent) io.Reader {
+		return content
+	})
+	if err != nil {
+		return err
+	}
+	if hash != fingerprint.Hash {
+		return fmt.Errorf("hash %s, want %s: %w", hash, fingerprint.Hash, ErrPlanMismatch)
+	}
+
+	return nil
+}
+
+// ApplyPlanContext сверяет все файлы плана с записанным состоянием и, только если ни один файл не изменился,
+// обрабатывает дубликаты действием action, пока не отменен контекст ctx. Действие должно совпадать с записанным в плане.
+// Если файлы изменились, ни один дубликат не обрабатывается: ошибки сверки возвращаются в RemoveResult.Errors
+// вместе с ошибкой ErrPlanMismatch.
+func (d *Duplicates) ApplyPlanContext(ctx context.Context, plan *Plan, action Action) (*RemoveResult, error) {
+	if action.String() != plan.Action {
+		return nil, fmt.Errorf("%s, plan %s: %w", action, plan.Action, ErrPlanAction)
+	}
+
+	d.progress.setStage(ProgressApply)
+	if errs := d.ValidatePlanContext(ctx, plan); len(errs) > 0 {
+		return &RemoveResult{Errors: errs, Incomplete: ctx.Err() != nil}, fmt.Errorf("%d files: %w", len(errs), ErrPlanMismatch)
+	}
+	if ctx.Err() != nil {
+		return &RemoveResult{Incomplete: true}, nil
+	}
+
+	reviews := make(map[string]Review, len(plan.Groups))
+	for _, group := range plan.Groups {
+		if len(group.Kept) == 0 || len(group.Duplicates) == 0 {
+			continue
+		}
+
+		review := Review{}
+		for _, fingerprint := range group.Kept {
+			review.Kept = append(review.Kept, plan.planFile(fingerprint))
+		}
+		for _, fingerprint := range group.Duplicates {
+			review.Duplicates = append(review.Duplicates, plan.planFile(fingerprint))
+		}
+		reviews[group.Key] = review
+	}
+
+	return d.applyReviews(ctx, action, reviews), nil
+}
+
+// planFile возвращает файл, описанный в плане
+func (p *Plan) planFile(fingerprint Fingerprint) File {
+	name := p.Path(fingerprint.Path)
+
+	return File{
+		Name:    filepath.Base(name),
+		Path:    name,
+		Size:    fingerprint.Size,
+		ModTime: fingerprint.ModTime,
+		Hash:    fingerprint.Hash,
+		Symlink: fingerprint.Symlink,
+	}
+}
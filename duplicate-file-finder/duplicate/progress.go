@@ -0,0 +1,139 @@
+package duplicate
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressStage этап работы поиска дубликатов
+type ProgressStage int32
+
+// Этапы работы поиска дубликатов
+const (
+	ProgressScan ProgressStage = iota
+	ProgressHash
+	ProgressApply
+)
+
+func (s ProgressStage) String() string {
+	switch s {
+	case ProgressScan:
+		return "scan"
+	case ProgressHash:
+		return "hash"
+	case ProgressApply:
+		return "apply"
+	}
+
+	return "unknown"
+}
+
+// Progress описывает ход поиска и обработки дубликатов
+type Progress struct {
+	Stage ProgressStage
+	// Dirs количество прочитанных директорий
+	Dirs int64
+	// Files количество найденных файлов, прошедших фильтр
+	Files int64
+	// HashedBytes количество байт, прочитанных при хэшировании
+	HashedBytes int64
+	// Groups количество найденных групп дубликатов, известно после группировки
+	Groups int64
+	// Duplicates количество дубликатов в найденных группах, известно после группировки
+	Duplicates int64
+	// Processed количество дубликатов, над которыми выполнено действие
+	Processed int64
+}
+
+// ProgressFunc получает снимки хода работы. Вызывается из отдельной горутины не чаще интервала,
+// заданного в WithProgress, и один раз в конце поиска или обработки дубликатов.
+type ProgressFunc func(progress Progress)
+
+// defaultProgressInterval интервал отправки хода работы, если в WithProgress задан интервал <= 0
+const defaultProgressInterval = 200 * time.Millisecond
+
+// WithProgress включает отправку хода работы в fn с интервалом interval
+func WithProgress(interval time.Duration, fn ProgressFunc) Option {
+	return func(d *Duplicates) {
+		if interval <= 0 {
+			interval = defaultProgressInterval
+		}
+
+		d.progressInterval = interval
+		d.progressFunc = fn
+	}
+}
+
+// progressCounters счетчики хода работы, изменяемые атомарно из рабочих горутин
+type progressCounters struct {
+	stage       int32
+	dirs        int64
+	files       int64
+	hashedBytes int64
+	groups      int64
+	duplicates  int64
+	processed   int64
+}
+
+// snapshot возвращает текущие значения счетчиков
+func (c *progressCounters) snapshot() Progress {
+	return Progress{
+		Stage:       ProgressStage(atomic.LoadInt32(&c.stage)),
+		Dirs:        atomic.LoadInt64(&c.dirs),
+		Files:       atomic.LoadInt64(&c.files),
+		HashedBytes: atomic.LoadInt64(&c.hashedBytes),
+		Groups:      atomic.LoadInt64(&c.groups),
+		Duplicates:  atomic.LoadInt64(&c.duplicates),
+		Processed:   atomic.LoadInt64(&c.processed),
+	}
+}
+
+// setStage переключает этап работы
+func (c *progressCounters) setStage(stage ProgressStage) {
+	atomic.StoreInt32(&c.stage, int32(stage))
+}
+
+// setGroups запоминает количество найденных групп и дубликатов в них
+func (c *progressCounters) setGroups(files Files) {
+	var duplicates int64
+	for _, group := range files {
+		duplicates += int64(len(group) - 1)
+	}
+
+	atomic.StoreInt64(&c.groups, int64(len(files)))
+	atomic.StoreInt64(&c.duplicates, duplicates)
+}
+
+// startProgress начинает периодическую отправку хода работы в progressFunc.
+// Возвращаемая функция останавливает отправку и отправляет последний снимок.
+func (d *Duplicates) startProgress() func() {
+	if d.progressFunc == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(d.progressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				d.progressFunc(d.progress.snapshot())
+			case <-done:
+				d.progressFunc(d.progress.snapshot())
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,277 @@
+package duplicate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrNoQuarantineDir Ошибка, обозначающая что для карантина не задана директория
+var ErrNoQuarantineDir = errors.New("quarantine dir is not set")
+
+// ErrRestoreTargetExists Ошибка, обозначающая что на месте восстанавливаемого файла уже появился другой файл
+var ErrRestoreTargetExists = errors.New("file already exists at original location")
+
+// QuarantineManifest имя файла манифеста в директории карантина
+const QuarantineManifest = "manifest.jsonl"
+
+// quarantineFilesDir директория внутри карантина, в которую перемещаются дубликаты
+const quarantineFilesDir = "files"
+
+// quarantineDirPerm права создаваемых директорий карантина
+const quarantineDirPerm = 0700
+
+// quarantineFilePerm права пустого файла, которым занимается путь в карантине до переименования дубликата
+const quarantineFilePerm = 0600
+
+// restoreDirPerm права директорий, создаваемых при восстановлении файлов
+const restoreDirPerm = 0755
+
+// QuarantineEntry описывает запись манифеста о перемещенном в карантин файле.
+// Относительные пути отсчитываются от WorkDir, если он задан.
+type QuarantineEntry struct {
+	Original    string      `json:"original"`
+	Quarantined string      `json:"quarantined"`
+	Kept        string      `json:"kept"`
+	WorkDir     string      `json:"workDir,omitempty"`
+	Size        int64       `json:"size"`
+	Mode        os.FileMode `json:"mode"`
+	ModTime     time.Time   `json:"modTime"`
+	Time        time.Time   `json:"time"`
+}
+
+// path возвращает путь относительно рабочей директории, в которой запись была создана
+func (e QuarantineEntry) path(name string) string {
+	if e.WorkDir == "" || filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(e.WorkDir, name)
+}
+
+// Manifest дописывает записи о перемещенных в карантин файлах в формате JSON Lines
+type Manifest struct {
+	writer jsonLinesWriter
+}
+
+// NewManifest создает манифест, записываемый в w
+func NewManifest(w io.Writer) *Manifest {
+	return &Manifest{writer: newJSONLinesWriter(w)}
+}
+
+// Add дописывает запись в манифест
+func (m *Manifest) Add(entry QuarantineEntry) error {
+	return m.writer.write(entry)
+}
+
+// ReadManifest читает все записи манифеста
+func ReadManifest(r io.Reader) ([]QuarantineEntry, error) {
+	var entries []QuarantineEntry
+	err := readJSONLines(r, func(line []byte) error {
+		var entry QuarantineEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read quarantine manifest: %w", err)
+	}
+
+	return entries, nil
+}
+
+// PruneManifest возвращает записи манифеста entries без файлов, которые вернула из карантина
+// отмена действий undone, чтобы restore не пытался восстановить их повторно
+func PruneManifest(entries []QuarantineEntry, undone []JournalEntry) []QuarantineEntry {
+	restored := make(map[string]bool, len(undone))
+	for _, entry := range undone {
+		if entry.Action == (QuarantineAction{}).String() {
+			restored[filepath.Clean(entry.path(entry.Target))] = true
+		}
+	}
+
+	remaining := make([]QuarantineEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !restored[filepath.Clean(entry.path(entry.Quarantined))] {
+			remaining = append(remaining, entry)
+		}
+	}
+
+	return remaining
+}
+
+// QuarantineAction перемещает дубликат в директорию карантина Dir, сохраняя его относительный путь,
+// и дописывает запись о перемещении в Manifest. WorkDir записывается в манифест,
+// чтобы восстановить файлы с относительными путями из любой рабочей директории.
+type QuarantineAction struct {
+	Dir      string
+	WorkDir  string
+	Manifest *Manifest
+}
+
+// Apply перемещает дубликат file в карантин и возвращает его путь в карантине
+func (a QuarantineAction) Apply(fs FSReadMutator, kept, file File) (string, error) {
+	if a.Dir == "" {
+		return "", ErrNoQuarantineDir
+	}
+
+	info, err := fs.Lstat(file.Path)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := a.claim(fs, file.Path)
+	if err != nil {
+		return "", err
+	}
+
+	if err = fs.Rename(file.Path, target); err != nil {
+		_ = fs.Remove(target)
+		if errors.Is(err, syscall.EXDEV) {
+			return "", crossDeviceError{err: err}
+		}
+
+		return "", err
+	}
+
+	if a.Manifest == nil {
+		return target, nil
+	}
+
+	err = a.Manifest.Add(QuarantineEntry{
+		Original:    file.Path,
+		Quarantined: target,
+		Kept:        kept.Path,
+		WorkDir:     a.WorkDir,
+		Size:        info.Size(),
+		Mode:        info.Mode(),
+		ModTime:     info.ModTime(),
+		Time:        time.Now(),
+	})
+	if err != nil {
+		_ = fs.Rename(target, file.Path)
+		return "", fmt.Errorf("write quarantine manifest: %w", err)
+	}
+
+	return target, nil
+}
+
+func (QuarantineAction) String() string {
+	return "quarantine"
+}
+
+// claim занимает свободный путь в карантине для файла filePath и возвращает его.
+// Путь занимается созданием пустого файла с O_EXCL, который затем заменяется дубликатом,
+// поэтому параллельный запуск не может выбрать тот же путь и перезаписать уже помещенный в карантин файл
+func (a QuarantineAction) claim(fs FSMutator, filePath string) (string, error) {
+	relPath, err := quarantineRelPath(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	base := filepath.Join(a.Dir, quarantineFilesDir, relPath)
+	if err = fs.MkdirAll(filepath.Dir(base), quarantineDirPerm); err != nil {
+		return "", err
+	}
+
+	target := base
+	var placeholder io.WriteCloser
+	for i := 1; ; i++ {
+		placeholder, err = fs.Create(target, quarantineFilePerm)
+		if err == nil {
+			if err = placeholder.Close(); err != nil {
+				_ = fs.Remove(target)
+				return "", err
+			}
+
+			return target, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+
+		target = fmt.Sprintf("%s.%d", base, i)
+	}
+}
+
+// quarantineRelPath возвращает путь файла внутри карантина. Относительные пути сохраняются,
+// абсолютные пути и пути, выходящие за рабочую директорию, сохраняются целиком от корня
+func quarantineRelPath(filePath string) (string, error) {
+	clean := filepath.Clean(filePath)
+	parent := ".." + string(filepath.Separator)
+	if !filepath.IsAbs(clean) && clean != ".." && !strings.HasPrefix(clean, parent) {
+		return clean, nil
+	}
+
+	abs, err := filepath.Abs(clean)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimLeft(abs[len(filepath.VolumeName(abs)):], string(filepath.Separator)), nil
+}
+
+// RestoreFailure описывает файл, который не удалось восстановить из карантина
+type RestoreFailure struct {
+	Entry  QuarantineEntry
+	Reason error
+}
+
+// RestoreResult описывает результат восстановления файлов из карантина
+type RestoreResult struct {
+	Restored []QuarantineEntry
+	Failed   []RestoreFailure
+}
+
+// Restore перемещает файлы из карантина на их исходные места.
+// Файл не восстанавливается, если на его исходном месте уже появился другой файл.
+func Restore(fs FSReadMutator, entries []QuarantineEntry) *RestoreResult {
+	result := &RestoreResult{}
+	for _, entry := range entries {
+		if err := restoreEntry(fs, entry); err != nil {
+			result.Failed = append(result.Failed, RestoreFailure{Entry: entry, Reason: err})
+			continue
+		}
+
+		result.Restored = append(result.Restored, entry)
+	}
+
+	return result
+}
+
+// restoreEntry возвращает на место один файл из карантина
+func restoreEntry(fs FSReadMutator, entry QuarantineEntry) error {
+	return restoreFile(fs, entry.path(entry.Quarantined), entry.path(entry.Original))
+}
+
+// restoreFile перемещает файл from на место original. Файл переносится жесткой ссылкой,
+// которая не перезаписывает существующий файл, после чего from удаляется
+func restoreFile(fs FSReadMutator, from, original string) error {
+	if _, err := fs.Lstat(original); err == nil {
+		return fmt.Errorf("%s: %w", original, ErrRestoreTargetExists)
+	}
+
+	if err := fs.MkdirAll(filepath.Dir(original), restoreDirPerm); err != nil {
+		return err
+	}
+
+	if err := fs.Link(from, original); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s: %w", original, ErrRestoreTargetExists)
+		}
+
+		return err
+	}
+
+	return fs.Remove(from)
+}
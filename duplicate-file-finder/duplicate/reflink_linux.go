@@ -0,0 +1,54 @@
+//go:build linux
+// +build linux
+
+package duplicate
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ficlone номер ioctl FICLONE из linux/fs.h
+const ficlone = 0x40049409
+
+// reflink клонирует src в новый файл dst через ioctl FICLONE (btrfs, XFS)
+func reflink(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = srcFile.Close()
+	}()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dstFile.Fd(), ficlone, srcFile.Fd())
+	closeErr := dstFile.Close()
+	if errno != 0 {
+		_ = os.Remove(dst)
+
+		switch errno {
+		case syscall.EOPNOTSUPP, syscall.EINVAL, syscall.EXDEV, syscall.ENOTTY, syscall.ENOSYS:
+			return fmt.Errorf("clone %s to %s: %v: %w", src, dst, errno, ErrReflinkUnsupported)
+		}
+
+		return &os.LinkError{Op: "clone", Old: src, New: dst, Err: errno}
+	}
+
+	if closeErr != nil {
+		_ = os.Remove(dst)
+		return closeErr
+	}
+
+	return nil
+}
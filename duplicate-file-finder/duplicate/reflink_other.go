@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package duplicate
+
+import "fmt"
+
+// reflink не поддерживается вне Linux
+func reflink(src, dst string) error {
+	return fmt.Errorf("clone %s to %s: %w", src, dst, ErrReflinkUnsupported)
+}
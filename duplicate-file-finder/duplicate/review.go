@@ -0,0 +1,134 @@
+package duplicate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrUnknownGroup Ошибка решения по группе, которой нет среди найденных дубликатов
+var ErrUnknownGroup = errors.New("unknown duplicate group")
+
+// ErrFileNotInGroup Ошибка решения, в котором указан файл не из группы дубликатов
+var ErrFileNotInGroup = errors.New("file is not in duplicate group")
+
+// ErrNothingKept Ошибка решения, в котором не остается ни одного файла, найденного не по символической ссылке
+var ErrNothingKept = errors.New("no regular file is kept")
+
+// Review описывает решение по группе дубликатов: какие файлы остаются, а над какими выполняется действие
+type Review struct {
+	// Kept файлы, которые остаются. Первый из них используется действием как оригинал
+	// и не может быть символической ссылкой.
+	Kept []File
+	// Duplicates файлы, над которыми выполняется действие
+	Duplicates []File
+}
+
+// NewReview создает решение, по которому в группе остаются файлы с номерами keep (с нуля), а остальные обрабатываются.
+// Жесткие и символические ссылки на оставляемые файлы не обрабатываются: это те же физические файлы.
+func NewReview(group Group, keep []int) (Review, error) {
+	selected := make(map[int]bool, len(keep))
+	for _, ind := range keep {
+		if ind < 0 || ind >= len(group.Files) {
+			return Review{}, fmt.Errorf("%d: %w", ind, ErrFileNotInGroup)
+		}
+		selected[ind] = true
+	}
+
+	var kept, rest []File
+	keptIDs := make(map[FileID]bool)
+	for ind, file := range group.Files {
+		if selected[ind] {
+			kept = append(kept, file)
+			keptIDs[file.ID] = true
+			continue
+		}
+		rest = append(rest, file)
+	}
+
+	kept, ok := orderSymlinks(kept)
+	if !ok {
+		return Review{}, fmt.Errorf("%q: %w", group.Key, ErrNothingKept)
+	}
+
+	review := Review{Kept: kept}
+	for _, file := range rest {
+		if file.ID != (FileID{}) && keptIDs[file.ID] {
+			continue
+		}
+		review.Duplicates = append(review.Duplicates, file)
+	}
+
+	// Символические ссылки обрабатываются раньше файлов, на которые они указывают
+	sort.SliceStable(review.Duplicates, func(i, j int) bool {
+		return review.Duplicates[i].Symlink && !review.Duplicates[j].Symlink
+	})
+
+	return review, nil
+}
+
+// ReviewByPolicy создает решение, по которому в группе остается один файл, выбранный правилом policy
+func ReviewByPolicy(group Group, policy KeepPolicy) Review {
+	files := make([]File, len(group.Files))
+	copy(files, group.Files)
+	sort.Sort(byKeepPolicy{files: files, policy: policy})
+
+	ordered, ok := orderSymlinks(files)
+	if !ok {
+		return Review{}
+	}
+
+	ordered = withoutKeptLinks(ordered)
+	return Review{Kept: ordered[:1], Duplicates: ordered[1:]}
+}
+
+// WastedBytes возвращает объем, который освободится после выполнения решения
+func (r Review) WastedBytes() int64 {
+	var wasted int64
+	for _, links := range physicalFiles(r.Duplicates) {
+		wasted += reclaimableBytes(links)
+	}
+
+	return wasted
+}
+
+// ApplyReviewedContext обрабатывает выбранным действием только дубликаты из решений reviews, пока не отменен контекст ctx.
+// Ключ reviews - ключ группы дубликатов. Группы без решения не обрабатываются.
+// Если решение ссылается на неизвестную группу или файл не из группы, ни один файл не обрабатывается.
+func (d *Duplicates) ApplyReviewedContext(ctx context.Context, action Action, reviews map[string]Review) (*RemoveResult, error) {
+	for key, review := range reviews {
+		if err := d.validateReview(key, review); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.applyReviews(ctx, action, reviews), nil
+}
+
+// validateReview проверяет, что решение относится к найденной группе и содержит только ее файлы
+func (d *Duplicates) validateReview(key string, review Review) error {
+	group, ok := d.files[key]
+	if !ok {
+		return fmt.Errorf("%q: %w", key, ErrUnknownGroup)
+	}
+
+	if len(review.Kept) == 0 || review.Kept[0].Symlink {
+		return fmt.Errorf("%q: %w", key, ErrNothingKept)
+	}
+
+	paths := make(map[string]bool, len(group))
+	for _, file := range group {
+		paths[file.Path] = true
+	}
+
+	for _, files := range [][]File{review.Kept, review.Duplicates} {
+		for _, file := range files {
+			if !paths[file.Path] {
+				return fmt.Errorf("%q: %w", file.Path, ErrFileNotInGroup)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package duplicate
+
+import (
+	"path"
+	"path/filepath"
+)
+
+// seekRoot стартовая директория поиска
+type seekRoot struct {
+	// path путь директории в том виде, в котором он записывается в File.Root
+	path string
+	// abs абсолютный путь директории, по которому сравниваются пересекающиеся стартовые директории
+	abs string
+}
+
+// newSeekRoots приводит стартовые директории к единому виду и убирает повторы.
+// Директории сравниваются по абсолютному пути без раскрытия символических ссылок.
+func newSeekRoots(roots []string) []seekRoot {
+	result := make([]seekRoot, 0, len(roots))
+	seen := make(map[string]bool, len(roots))
+	for _, root := range roots {
+		root = path.Clean(root)
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			abs = root
+		}
+
+		if seen[abs] {
+			continue
+		}
+		seen[abs] = true
+
+		result = append(result, seekRoot{path: root, abs: abs})
+	}
+
+	return result
+}
+
+// nestedRoots возвращает абсолютные пути стартовых директорий, которые находятся внутри других стартовых директорий.
+// Такие директории обходятся только от своего корня, поэтому каждый файл находится один раз
+// и относится к самой вложенной стартовой директории.
+func nestedRoots(roots []seekRoot) map[string]bool {
+	nested := make(map[string]bool)
+	for _, root := range roots {
+		for _, other := range roots {
+			if root.abs != other.abs && insideDir(other.abs, root.abs) {
+				nested[root.abs] = true
+			}
+		}
+	}
+
+	return nested
+}
+
+// isNestedRoot проверяет, что поддиректория relPath стартовой директории task является другой стартовой директорией
+func (d *Duplicates) isNestedRoot(task dirTask, relPath string) bool {
+	if len(d.nestedRoots) == 0 {
+		return false
+	}
+
+	return d.nestedRoots[filepath.Join(task.root.abs, filepath.FromSlash(relPath))]
+}
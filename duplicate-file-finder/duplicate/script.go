@@ -0,0 +1,87 @@
+package duplicate
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrActionNotScriptable Ошибка, обозначающая что действие нельзя записать в shell-скрипт
+var ErrActionNotScriptable = errors.New("action can't be written as shell script")
+
+// ScriptFormatter выводит POSIX shell-скрипт, который выполняет действие Action над дубликатами.
+// Скрипт можно просмотреть, отредактировать и запустить позже. Если задан Dir, скрипт сначала переходит в него,
+// чтобы относительные пути работали при запуске из любой директории. Каждая группа начинается с комментария
+// с оставляемым файлом и проверки, что он существует, а перед действием над дубликатом скрипт сравнивает его
+// с оставляемым файлом через cmp и останавливается, если содержимое отличается. Для reflink используется cp
+// из GNU coreutils.
+type ScriptFormatter struct {
+	Action Action
+	Dir    string
+}
+
+// Format выводит скрипт для всех групп дубликатов
+func (f ScriptFormatter) Format(out io.Writer, report Report) error {
+	action := f.Action
+	if action == nil {
+		action = RemoveAction{}
+	}
+
+	w := bufio.NewWriter(out)
+	_, _ = fmt.Fprintln(w, "#!/bin/sh")
+	_, _ = fmt.Fprintf(w, "# duplicate-file-finder: action=%s match=%s\n", action, report.Match)
+	_, _ = fmt.Fprintln(w, "set -e")
+	if f.Dir != "" {
+		_, _ = fmt.Fprintf(w, "cd -- %s\n", shellQuote(f.Dir))
+	}
+
+	for _, group := range report.Groups {
+		kept := group.Files[0]
+		_, _ = fmt.Fprintln(w)
+		_, _ = fmt.Fprintf(w, "# group: %s\n", strconv.QuoteToASCII(group.Key))
+		_, _ = fmt.Fprintf(w, "# keep: %s\n", strconv.QuoteToASCII(kept.Path))
+		_, _ = fmt.Fprintf(w, "test -e %s\n", shellQuote(kept.Path))
+
+		for _, file := range group.Files[1:] {
+			command, err := scriptCommand(action, kept, file)
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(w, "cmp -s -- %s %s || { printf 'content differs: %%s\\n' %s >&2; exit 1; }\n",
+				shellQuote(kept.Path), shellQuote(file.Path), shellQuote(file.Path))
+			_, _ = fmt.Fprintln(w, command)
+		}
+	}
+
+	return w.Flush()
+}
+
+// scriptCommand возвращает команду shell, которая выполняет action над дубликатом file
+func scriptCommand(action Action, kept, file File) (string, error) {
+	switch a := action.(type) {
+	case RemoveAction:
+		return "rm -f -- " + shellQuote(file.Path), nil
+	case HardlinkAction:
+		return "ln -f -- " + shellQuote(kept.Path) + " " + shellQuote(file.Path), nil
+	case SymlinkAction:
+		target, err := a.target(kept, file)
+		if err != nil {
+			return "", err
+		}
+
+		return "ln -sf -- " + shellQuote(target) + " " + shellQuote(file.Path), nil
+	case ReflinkAction:
+		return "cp --reflink=always -f -- " + shellQuote(kept.Path) + " " + shellQuote(file.Path), nil
+	}
+
+	return "", fmt.Errorf("%s: %w", action, ErrActionNotScriptable)
+}
+
+// shellQuote заключает строку в одинарные кавычки. Внутри одинарных кавычек shell не интерпретирует
+// никакие символы, включая перевод строки и байты вне UTF-8, поэтому экранировать нужно только саму кавычку.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
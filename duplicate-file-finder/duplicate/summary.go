@@ -0,0 +1,172 @@
+package duplicate
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"text/tabwriter"
+)
+
+// DefaultSummaryTop количество групп и директорий в топах сводки по умолчанию
+const DefaultSummaryTop = 10
+
+// Summary описывает сводку результатов поиска
+type Summary struct {
+	// Files количество найденных файлов, прошедших фильтр
+	Files int64
+	// Dirs количество прочитанных директорий
+	Dirs int64
+	// Groups количество групп дубликатов
+	Groups int
+	// Duplicates количество дубликатов во всех группах, без оставляемых файлов
+	Duplicates int
+	// ReclaimableBytes объем, который освободится после обработки всех дубликатов
+	ReclaimableBytes int64
+	// TopGroups группы с наибольшим объемом, который освободится после их обработки
+	TopGroups []GroupSummary
+	// TopDirs директории, в которых дубликаты занимают больше всего места
+	TopDirs []DirSummary
+}
+
+// GroupSummary описывает группу дубликатов в сводке
+type GroupSummary struct {
+	Key   string
+	Files int
+	// WastedBytes объем, который освободится после обработки группы
+	WastedBytes int64
+}
+
+// DirSummary описывает директорию с дубликатами в сводке
+type DirSummary struct {
+	Dir string
+	// Files количество дубликатов в директории
+	Files int
+	// Bytes объем дубликатов в директории
+	Bytes int64
+}
+
+// WithSummaryTop задает количество групп и директорий в топах сводки. n <= 0 - DefaultSummaryTop
+func WithSummaryTop(n int) Option {
+	return func(d *Duplicates) {
+		if n > 0 {
+			d.summaryTop = n
+		}
+	}
+}
+
+// Summary возвращает сводку результатов последнего поиска
+func (d *Duplicates) Summary() Summary {
+	return d.newSummary(sortedGroups(d.files))
+}
+
+// newSummary считает сводку по группам дубликатов. В топы попадает не больше d.summaryTop групп и директорий.
+// Объем дубликатов в директории считается по файлам, найденным не по символической ссылке.
+func (d *Duplicates) newSummary(groups []Group) Summary {
+	top := d.summaryTop
+	summary := Summary{Files: int64(len(d.scanned)), Dirs: atomic.LoadInt64(&d.progress.dirs), Groups: len(groups)}
+
+	topGroups := make([]GroupSummary, 0, len(groups))
+	byDir := make(map[string]*DirSummary)
+	for _, group := range groups {
+		wasted := group.WastedBytes()
+		summary.Duplicates += len(group.Files) - 1
+		summary.ReclaimableBytes += wasted
+		topGroups = append(topGroups, GroupSummary{Key: group.Key, Files: len(group.Files), WastedBytes: wasted})
+
+		for _, file := range group.Files[1:] {
+			if file.Symlink {
+				continue
+			}
+
+			dir := filepath.Dir(file.Path)
+			if byDir[dir] == nil {
+				byDir[dir] = &DirSummary{Dir: dir}
+			}
+			byDir[dir].Files++
+			byDir[dir].Bytes += file.Size
+		}
+	}
+
+	sort.SliceStable(topGroups, func(i, j int) bool {
+		return topGroups[i].WastedBytes > topGroups[j].WastedBytes
+	})
+	if len(topGroups) > top {
+		topGroups = topGroups[:top]
+	}
+	summary.TopGroups = topGroups
+
+	topDirs := make([]DirSummary, 0, len(byDir))
+	for _, dir := range byDir {
+		topDirs = append(topDirs, *dir)
+	}
+	sort.Slice(topDirs, func(i, j int) bool {
+		if topDirs[i].Bytes != topDirs[j].Bytes {
+			return topDirs[i].Bytes > topDirs[j].Bytes
+		}
+
+		return topDirs[i].Dir < topDirs[j].Dir
+	})
+	if len(topDirs) > top {
+		topDirs = topDirs[:top]
+	}
+	summary.TopDirs = topDirs
+
+	return summary
+}
+
+// FormatBytes возвращает размер в байтах в виде 1.5 MiB
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// formatSummary выводит сводку таблицами с размерами в удобном для чтения виде
+func formatSummary(out io.Writer, summary Summary) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	_, _ = fmt.Fprintf(w, "%s\t%d\t\n", "Scanned Files", summary.Files)
+	_, _ = fmt.Fprintf(w, "%s\t%d\t\n", "Scanned Dirs", summary.Dirs)
+	_, _ = fmt.Fprintf(w, "%s\t%d\t\n", "Duplicate Groups", summary.Groups)
+	_, _ = fmt.Fprintf(w, "%s\t%d\t\n", "Duplicate Files", summary.Duplicates)
+	_, _ = fmt.Fprintf(w, "%s\t%s\t\n", "Reclaimable", FormatBytes(summary.ReclaimableBytes))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(summary.TopGroups) > 0 {
+		_, _ = fmt.Fprintln(out)
+		w = tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t\n", "Top Groups", "Files", "Wasted")
+		for _, group := range summary.TopGroups {
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t\n", group.Key, group.Files, FormatBytes(group.WastedBytes))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(summary.TopDirs) > 0 {
+		_, _ = fmt.Fprintln(out)
+		w = tabwriter.NewWriter(out, 0, 0, 3, ' ', tabwriter.AlignRight|tabwriter.Debug)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t\n", "Top Dirs", "Duplicates", "Size")
+		for _, dir := range summary.TopDirs {
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t\n", dir.Dir, dir.Files, FormatBytes(dir.Bytes))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package duplicate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSymlinkLoop Ошибка раскрытия пути, в котором слишком много или зацикленные символические ссылки
+var ErrSymlinkLoop = errors.New("too many levels of symbolic links")
+
+// maxSymlinks максимальное количество символических ссылок, которые раскрываются в одном пути
+const maxSymlinks = 40
+
+// WithFollowSymlinks включает переход по символическим ссылкам при сканировании.
+// По умолчанию символические ссылки пропускаются. При переходе по ссылкам каждая директория
+// читается один раз: повторный вход в нее по другому пути, в том числе по зацикленной ссылке, пропускается.
+func WithFollowSymlinks(follow bool) Option {
+	return func(d *Duplicates) {
+		d.followSymlinks = follow
+	}
+}
+
+// resolveEntry возвращает информацию о записи директории. Символическая ссылка пропускается,
+// если переход по ссылкам выключен, иначе заменяется информацией о файле или директории, на которые она указывает.
+func (d *Duplicates) resolveEntry(entryPath string, info os.FileInfo) (os.FileInfo, bool) {
+	if info.Mode()&os.ModeSymlink == 0 {
+		return info, true
+	}
+
+	if !d.followSymlinks {
+		d.logger.Info("Skip symlink " + entryPath)
+		return nil, false
+	}
+
+	target, err := d.fs.Stat(entryPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			d.logger.Warn("Skip broken symlink " + entryPath)
+			return nil, false
+		}
+
+		d.addError(OpFollow, entryPath, err)
+		return nil, false
+	}
+
+	return target, true
+}
+
+// enterDir отмечает директорию как прочитанную. false означает, что директория уже была прочитана
+// по другому пути. Директории учитываются только при переходе по символическим ссылкам:
+// без него обход дерева не может зациклиться или попасть в одну директорию дважды.
+func (d *Duplicates) enterDir(info os.FileInfo) bool {
+	if !d.followSymlinks {
+		return true
+	}
+
+	id, ok := fileID(info)
+	if !ok {
+		return true
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.visited[id] {
+		return false
+	}
+	d.visited[id] = true
+
+	return true
+}
+
+// enterRoots отмечает стартовые директории как прочитанные и убирает директории, которые уже встречались по другому пути
+func (d *Duplicates) enterRoots(roots []seekRoot) []seekRoot {
+	d.visited = make(map[FileID]bool)
+	if !d.followSymlinks {
+		return roots
+	}
+
+	result := roots[:0:0]
+	for _, root := range roots {
+		info, err := d.fs.Stat(root.path)
+		if err != nil || d.enterDir(info) {
+			result = append(result, root)
+			continue
+		}
+
+		d.logger.Info("Skip already visited root " + root.path)
+	}
+
+	return result
+}
+
+// orderSymlinks переставляет файлы отсортированной группы так, что оставляемым становится первый файл,
+// найденный не по символической ссылке, а сразу за ним идут символические ссылки. Ссылки обрабатываются
+// раньше файлов, на которые они указывают, пока эти файлы еще существуют.
+// false означает, что в группе нет ни одного файла, найденного не по ссылке.
+func orderSymlinks(group []File) ([]File, bool) {
+	kept := -1
+	for ind, file := range group {
+		if !file.Symlink {
+			kept = ind
+			break
+		}
+	}
+
+	if kept < 0 {
+		return nil, false
+	}
+
+	result := make([]File, 0, len(group))
+	result = append(result, group[kept])
+	for _, file := range group {
+		if file.Symlink {
+			result = append(result, file)
+		}
+	}
+	for ind, file := range group {
+		if !file.Symlink && ind != kept {
+			result = append(result, file)
+		}
+	}
+
+	return result, true
+}
+
+// realPath возвращает путь name, в котором раскрыты все символические ссылки.
+// Относительная цель ссылки отсчитывается от директории ссылки.
+func (d *Duplicates) realPath(name string) (string, error) {
+	separator := string(filepath.Separator)
+	resolved, rest := "", filepath.Clean(name)
+	if filepath.IsAbs(rest) {
+		resolved, rest = separator, strings.TrimPrefix(rest, separator)
+	}
+
+	hops := 0
+	for rest != "" {
+		part := rest
+		if ind := strings.Index(rest, separator); ind >= 0 {
+			part, rest = rest[:ind], rest[ind+1:]
+		} else {
+			rest = ""
+		}
+
+		next := filepath.Join(resolved, part)
+		info, err := d.fs.Lstat(next)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		hops++
+		if hops > maxSymlinks {
+			return "", fmt.Errorf("%s: %w", name, ErrSymlinkLoop)
+		}
+
+		target, err := d.fs.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(resolved, target)
+		}
+
+		// Путь раскрывается заново от цели ссылки
+		resolved, rest = "", filepath.Join(target, rest)
+		if filepath.IsAbs(rest) {
+			resolved, rest = separator, strings.TrimPrefix(rest, separator)
+		}
+	}
+
+	return resolved, nil
+}
@@ -1,9 +1,21 @@
 package duplicate
 
+import "time"
+
+// TestModTime время изменения файлов в тестовых данных
+var TestModTime = time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// SHA-256 содержимого copy1.txt и copy2.txt в тестовых данных
+const (
+	copy1Hash = "8206c4027f8a63c28c16353c2b2ec9470e945506a9ba7209f0ae383936b0b242"
+	copy2Hash = "8ef80b85682812c22d0a421fffd7e5f58c81d7fc03386c772c6ff311098712c1"
+)
+
 var FilesTestData = []struct {
 	Name             string
 	StartDir         string
 	MaxDepth         int
+	Match            MatchMode
 	WantResult       Files
 	WantDeletedFiles []string
 	WantPresentFiles []string
@@ -15,13 +27,13 @@ var FilesTestData = []struct {
 		MaxDepth: 0,
 		WantResult: Files{
 			"copy1.txt_28": []File{
-				{Name: "copy1.txt", Path: "tmp/copy1.txt", Size: 28},
-				{Name: "copy1.txt", Path: "tmp/A/copy1.txt", Size: 28},
-				{Name: "copy1.txt", Path: "tmp/A/AA/copy1.txt", Size: 28},
+				{Name: "copy1.txt", Path: "tmp/copy1.txt", Size: 28, ModTime: TestModTime, Root: "tmp"},
+				{Name: "copy1.txt", Path: "tmp/A/copy1.txt", Size: 28, ModTime: TestModTime, Root: "tmp"},
+				{Name: "copy1.txt", Path: "tmp/A/AA/copy1.txt", Size: 28, ModTime: TestModTime, Root: "tmp"},
 			},
 			"copy2.txt_28": []File{
-				{Name: "copy2.txt", Path: "tmp/copy2.txt", Size: 28},
-				{Name: "copy2.txt", Path: "tmp/B/copy2.txt", Size: 28},
+				{Name: "copy2.txt", Path: "tmp/copy2.txt", Size: 28, ModTime: TestModTime, Root: "tmp"},
+				{Name: "copy2.txt", Path: "tmp/B/copy2.txt", Size: 28, ModTime: TestModTime, Root: "tmp"},
 			},
 		},
 		WantDeletedFiles: []string{
@@ -32,13 +44,29 @@ var FilesTestData = []struct {
 		WantPresentFiles: []string{
 			"tmp/unique.txt",
 			"tmp/A/AB/copy1.txt",
+			"tmp/B/renamed.txt",
 		},
-		WantPrinted: `   File Name|            File Path|   File Size|
-   copy1.txt|        tmp/copy1.txt|          28|
-   copy1.txt|      tmp/A/copy1.txt|          28|
-   copy1.txt|   tmp/A/AA/copy1.txt|          28|
-   copy2.txt|        tmp/copy2.txt|          28|
-   copy2.txt|      tmp/B/copy2.txt|          28|
+		WantPrinted: `   Keep|   File Name|            File Path|   File Size|
+      *|   copy1.txt|        tmp/copy1.txt|          28|
+       |   copy1.txt|      tmp/A/copy1.txt|          28|
+       |   copy1.txt|   tmp/A/AA/copy1.txt|          28|
+      *|   copy2.txt|        tmp/copy2.txt|          28|
+       |   copy2.txt|      tmp/B/copy2.txt|          28|
+
+      Scanned Files|      8|
+       Scanned Dirs|      5|
+   Duplicate Groups|      2|
+    Duplicate Files|      3|
+        Reclaimable|   84 B|
+
+     Top Groups|   Files|   Wasted|
+   copy1.txt_28|       3|     56 B|
+   copy2.txt_28|       2|     28 B|
+
+   Top Dirs|   Duplicates|   Size|
+      tmp/A|            1|   28 B|
+   tmp/A/AA|            1|   28 B|
+      tmp/B|            1|   28 B|
 `,
 	},
 
@@ -48,12 +76,12 @@ var FilesTestData = []struct {
 		MaxDepth: 2,
 		WantResult: Files{
 			"copy1.txt_28": []File{
-				{Name: "copy1.txt", Path: "tmp/copy1.txt", Size: 28},
-				{Name: "copy1.txt", Path: "tmp/A/copy1.txt", Size: 28},
+				{Name: "copy1.txt", Path: "tmp/copy1.txt", Size: 28, ModTime: TestModTime, Root: "tmp"},
+				{Name: "copy1.txt", Path: "tmp/A/copy1.txt", Size: 28, ModTime: TestModTime, Root: "tmp"},
 			},
 			"copy2.txt_28": []File{
-				{Name: "copy2.txt", Path: "tmp/copy2.txt", Size: 28},
-				{Name: "copy2.txt", Path: "tmp/B/copy2.txt", Size: 28},
+				{Name: "copy2.txt", Path: "tmp/copy2.txt", Size: 28, ModTime: TestModTime, Root: "tmp"},
+				{Name: "copy2.txt", Path: "tmp/B/copy2.txt", Size: 28, ModTime: TestModTime, Root: "tmp"},
 			},
 		},
 		WantDeletedFiles: []string{
@@ -64,12 +92,81 @@ var FilesTestData = []struct {
 			"tmp/unique.txt",
 			"tmp/A/AA/copy1.txt",
 			"tmp/A/AB/copy1.txt",
+			"tmp/B/renamed.txt",
 		},
-		WantPrinted: `   File Name|         File Path|   File Size|
-   copy1.txt|     tmp/copy1.txt|          28|
-   copy1.txt|   tmp/A/copy1.txt|          28|
-   copy2.txt|     tmp/copy2.txt|          28|
-   copy2.txt|   tmp/B/copy2.txt|          28|
+		WantPrinted: `   Keep|   File Name|         File Path|   File Size|
+      *|   copy1.txt|     tmp/copy1.txt|          28|
+       |   copy1.txt|   tmp/A/copy1.txt|          28|
+      *|   copy2.txt|     tmp/copy2.txt|          28|
+       |   copy2.txt|   tmp/B/copy2.txt|          28|
+
+      Scanned Files|      6|
+       Scanned Dirs|      3|
+   Duplicate Groups|      2|
+    Duplicate Files|      2|
+        Reclaimable|   56 B|
+
+     Top Groups|   Files|   Wasted|
+   copy1.txt_28|       2|     28 B|
+   copy2.txt_28|       2|     28 B|
+
+   Top Dirs|   Duplicates|   Size|
+      tmp/A|            1|   28 B|
+      tmp/B|            1|   28 B|
+`,
+	},
+
+	{
+		Name:     "Match Content",
+		StartDir: "./tmp",
+		MaxDepth: 0,
+		Match:    MatchContent,
+		WantResult: Files{
+			copy1Hash: []File{
+				{Name: "copy1.txt", Path: "tmp/copy1.txt", Size: 28, ModTime: TestModTime, Hash: copy1Hash, Root: "tmp"},
+				{Name: "copy1.txt", Path: "tmp/A/copy1.txt", Size: 28, ModTime: TestModTime, Hash: copy1Hash, Root: "tmp"},
+				{Name: "copy1.txt", Path: "tmp/A/AA/copy1.txt", Size: 28, ModTime: TestModTime, Hash: copy1Hash, Root: "tmp"},
+			},
+			copy2Hash: []File{
+				{Name: "copy2.txt", Path: "tmp/copy2.txt", Size: 28, ModTime: TestModTime, Hash: copy2Hash, Root: "tmp"},
+				{Name: "copy2.txt", Path: "tmp/B/copy2.txt", Size: 28, ModTime: TestModTime, Hash: copy2Hash, Root: "tmp"},
+				{Name: "renamed.txt", Path: "tmp/B/renamed.txt", Size: 28, ModTime: TestModTime, Hash: copy2Hash, Root: "tmp"},
+			},
+		},
+		WantDeletedFiles: []string{
+			"tmp/A/copy1.txt",
+			"tmp/A/AA/copy1.txt",
+			"tmp/B/copy2.txt",
+			"tmp/B/renamed.txt",
+		},
+		WantPresentFiles: []string{
+			"tmp/unique.txt",
+			"tmp/copy1.txt",
+			"tmp/copy2.txt",
+			"tmp/A/AB/copy1.txt",
+		},
+		WantPrinted: `   Keep|     File Name|            File Path|   File Size|
+      *|     copy1.txt|        tmp/copy1.txt|          28|
+       |     copy1.txt|      tmp/A/copy1.txt|          28|
+       |     copy1.txt|   tmp/A/AA/copy1.txt|          28|
+      *|     copy2.txt|        tmp/copy2.txt|          28|
+       |     copy2.txt|      tmp/B/copy2.txt|          28|
+       |   renamed.txt|    tmp/B/renamed.txt|          28|
+
+      Scanned Files|       8|
+       Scanned Dirs|       5|
+   Duplicate Groups|       2|
+    Duplicate Files|       4|
+        Reclaimable|   112 B|
+
+                                                         Top Groups|   Files|   Wasted|
+   8206c4027f8a63c28c16353c2b2ec9470e945506a9ba7209f0ae383936b0b242|       3|     56 B|
+   8ef80b85682812c22d0a421fffd7e5f58c81d7fc03386c772c6ff311098712c1|       3|     56 B|
+
+   Top Dirs|   Duplicates|   Size|
+      tmp/B|            2|   56 B|
+      tmp/A|            1|   28 B|
+   tmp/A/AA|            1|   28 B|
 `,
 	},
 }
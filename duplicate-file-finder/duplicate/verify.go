@@ -0,0 +1,68 @@
+package duplicate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrContentMismatch Ошибка, обозначающая что содержимое дубликата отличается от оставляемого файла
+var ErrContentMismatch = errors.New("content differs from kept file")
+
+// verifyBufferSize размер буфера побайтового сравнения файлов
+const verifyBufferSize = 32 * 1024
+
+// compareContent потоково сравнивает содержимое дубликата с оставляемым файлом.
+// Возвращает ErrContentMismatch, если файлы отличаются, и ошибку контекста, если сравнение прервано.
+func (d *Duplicates) compareContent(ctx context.Context, kept, file File) error {
+	keptContent, err := d.fs.Open(kept.Path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = keptContent.Close()
+	}()
+
+	fileContent, err := d.fs.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fileContent.Close()
+	}()
+
+	keptBuf := make([]byte, verifyBufferSize)
+	fileBuf := make([]byte, verifyBufferSize)
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		keptN, keptErr := io.ReadFull(keptContent, keptBuf)
+		fileN, fileErr := io.ReadFull(fileContent, fileBuf)
+
+		if !bytes.Equal(keptBuf[:keptN], fileBuf[:fileN]) {
+			return fmt.Errorf("%s and %s: %w", kept.Path, file.Path, ErrContentMismatch)
+		}
+
+		keptEOF := isEOF(keptErr)
+		fileEOF := isEOF(fileErr)
+		switch {
+		case keptErr != nil && !keptEOF:
+			return fmt.Errorf("read %s: %w", kept.Path, keptErr)
+		case fileErr != nil && !fileEOF:
+			return fmt.Errorf("read %s: %w", file.Path, fileErr)
+		case keptEOF != fileEOF:
+			return fmt.Errorf("%s and %s: %w", kept.Path, file.Path, ErrContentMismatch)
+		case keptEOF:
+			return nil
+		}
+	}
+}
+
+// isEOF проверяет, что чтение блока закончилось концом файла
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,104 @@
+package duplicate
+
+import (
+	"context"
+	"sync"
+)
+
+// dirTask описывает директорию в очереди обхода
+type dirTask struct {
+	// root стартовая директория, от которой найдена директория
+	root seekRoot
+	path string
+	// relPath путь директории относительно стартовой
+	relPath string
+	level   int
+	// rules правила игнорирования, действующие в директории
+	rules ignoreRules
+}
+
+// dirQueue очередь директорий, которые ожидают чтения воркерами.
+// pending учитывает директории в очереди и директории, которые сейчас читаются:
+// обход завершен, когда pending становится равным нулю.
+type dirQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	tasks   []dirTask
+	pending int
+}
+
+// newDirQueue создает очередь со стартовыми директориями roots
+func newDirQueue(roots []dirTask) *dirQueue {
+	q := &dirQueue{tasks: roots, pending: len(roots)}
+	q.cond = sync.NewCond(&q.mu)
+
+	return q
+}
+
+// pop возвращает следующую директорию. Если очередь пуста, pop ждет,
+// пока воркеры добавят новые директории или обход завершится. false означает, что обход завершен.
+func (q *dirQueue) pop() (dirTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.tasks) == 0 && q.pending > 0 {
+		q.cond.Wait()
+	}
+
+	if len(q.tasks) == 0 {
+		return dirTask{}, false
+	}
+
+	last := len(q.tasks) - 1
+	task := q.tasks[last]
+	q.tasks = q.tasks[:last]
+
+	return task, true
+}
+
+// done отмечает, что директория прочитана, и добавляет в очередь найденные в ней поддиректории
+func (q *dirQueue) done(children []dirTask) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.tasks = append(q.tasks, children...)
+	q.pending += len(children) - 1
+
+	if len(children) > 0 || q.pending == 0 {
+		q.cond.Broadcast()
+	}
+}
+
+// walk обходит деревья стартовых директорий пулом из d.jobs воркеров. Количество одновременно
+// читаемых директорий и запущенных горутин не зависит от размера деревьев.
+// После отмены ctx оставшиеся в очереди директории не читаются.
+func (d *Duplicates) walk(ctx context.Context, roots []seekRoot, maxDepth int) {
+	tasks := make([]dirTask, len(roots))
+	for ind, root := range roots {
+		tasks[ind] = dirTask{root: root, path: root.path, level: 1}
+	}
+	queue := newDirQueue(tasks)
+
+	var wg sync.WaitGroup
+	for i := 0; i < d.jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				task, ok := queue.pop()
+				if !ok {
+					return
+				}
+
+				if ctx.Err() != nil {
+					queue.done(nil)
+					continue
+				}
+
+				queue.done(d.scanDir(task, maxDepth))
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/phpCoder88/geekbrains-go2/duplicate-file-finder/duplicate"
+)
+
+// exitErrors код выхода, если при поиске или обработке дубликатов возникли ошибки
+const exitErrors = 1
+
+// reportErrors выводит ошибки этапа stage и их сводку в stderr. Возвращает true, если ошибки были.
+func reportErrors(stage string, errs duplicate.PathErrors) bool {
+	if len(errs) == 0 {
+		return false
+	}
+
+	var permission, notExist, vanished, other int
+	for _, err := range errs {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+
+		switch {
+		case errors.Is(err, duplicate.ErrFileVanished):
+			vanished++
+		case errors.Is(err, os.ErrPermission):
+			permission++
+		case errors.Is(err, os.ErrNotExist):
+			notExist++
+		default:
+			other++
+		}
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "%s: ошибок %d (нет доступа: %d, не существует: %d, исчезли при обработке: %d, другие: %d)\n",
+		stage, len(errs), permission, notExist, vanished, other)
+
+	return true
+}
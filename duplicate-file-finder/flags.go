@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errInvalidSize Ошибка разбора размера файла
+var errInvalidSize = errors.New("invalid size")
+
+// sizeUnits множители суффиксов размера файла
+var sizeUnits = map[string]int64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// stringList значение флага, который можно указать несколько раз
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set добавляет очередное значение флага
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// stringListFlag определяет флаг name, который можно указать несколько раз, и возвращает список его значений
+func stringListFlag(name, usage string) *stringList {
+	list := new(stringList)
+	flag.Var(list, name, usage)
+
+	return list
+}
+
+// sizeValue значение флага с размером файла в байтах. Допускаются суффиксы K, M, G, T (степени 1024), в том числе с B: KB, MB.
+type sizeValue int64
+
+func (s *sizeValue) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+// Set разбирает размер файла, например 512, 10K или 1.5MB
+func (s *sizeValue) Set(value string) error {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	number := strings.TrimRight(value, "BKMGT")
+	unit := strings.TrimSuffix(value[len(number):], "B")
+
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return fmt.Errorf("%q: %w", value, errInvalidSize)
+	}
+
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("%q: %w", value, errInvalidSize)
+	}
+
+	*s = sizeValue(size * float64(multiplier))
+	return nil
+}
+
+// sizeFlag определяет флаг name с размером файла и возвращает его значение в байтах
+func sizeFlag(name, usage string) *sizeValue {
+	size := new(sizeValue)
+	flag.Var(size, name, usage)
+
+	return size
+}
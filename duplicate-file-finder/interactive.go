@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/phpCoder88/geekbrains-go2/duplicate-file-finder/duplicate"
+)
+
+// errInteractiveWithoutAction Ошибка запуска интерактивного режима без действия над дубликатами
+var errInteractiveWithoutAction = errors.New("flag --interactive requires --action or -remove")
+
+// errInteractiveScript Ошибка одновременного указания интерактивного режима и записи скрипта
+var errInteractiveScript = errors.New("flag --interactive conflicts with --script")
+
+// errUnknownReviewCommand Ошибка разбора неизвестной команды интерактивного режима
+var errUnknownReviewCommand = errors.New("unknown command")
+
+// errUnknownFileNumber Ошибка выбора файла, номера которого нет в группе
+var errUnknownFileNumber = errors.New("no file with this number in group")
+
+// reviewHelp описание команд интерактивного режима
+const reviewHelp = `Команды:
+  Enter          оставить предложенный файл (отмечен *)
+  1 3            оставить файлы с указанными номерами, остальные обработать
+  s              пропустить группу
+  a              оставить предложенные файлы в этой и всех оставшихся группах
+  a ПРАВИЛО      выбрать оставляемый файл правилом --keep в этой и всех оставшихся группах, например a oldest
+  q              закончить просмотр, оставшиеся группы не обрабатываются
+`
+
+// reviewPrompt приглашение ввода команды интерактивного режима
+const reviewPrompt = "Оставить (Enter, номера, s, a [ПРАВИЛО], q, ?): "
+
+// reviewCommand команда интерактивного режима
+type reviewCommand int
+
+// Команды интерактивного режима
+const (
+	reviewKeep reviewCommand = iota
+	reviewSkip
+	reviewAll
+	reviewQuit
+	reviewHelpCommand
+)
+
+// reviewGroups показывает группы дубликатов по одной, начиная с групп, обработка которых освободит больше всего места,
+// и спрашивает, какие файлы оставить. Возвращает решения по одобренным группам.
+// Конец ввода равносилен команде q.
+func reviewGroups(in *bufio.Reader, out io.Writer, groups []duplicate.Group) (map[string]duplicate.Review, error) {
+	sorted := make([]duplicate.Group, len(groups))
+	copy(sorted, groups)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].WastedBytes() > sorted[j].WastedBytes()
+	})
+
+	reviews := make(map[string]duplicate.Review)
+	var rule duplicate.KeepPolicy
+	applyRest := false
+	for ind, group := range sorted {
+		if applyRest {
+			reviews[group.Key] = reviewByRule(group, rule)
+			continue
+		}
+
+		printGroup(out, ind+1, len(sorted), group)
+		for {
+			_, _ = fmt.Fprint(out, reviewPrompt)
+			line, err := in.ReadString('\n')
+			if errors.Is(err, io.EOF) && line == "" {
+				_, _ = fmt.Fprintln(out)
+				return reviews, nil
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+
+			command, review, policy, err := parseReviewCommand(strings.TrimSpace(line), group)
+			if err != nil {
+				_, _ = fmt.Fprintln(out, err)
+				continue
+			}
+
+			switch command {
+			case reviewKeep:
+				reviews[group.Key] = review
+			case reviewAll:
+				rule, applyRest = policy, true
+				reviews[group.Key] = reviewByRule(group, rule)
+			case reviewQuit:
+				return reviews, nil
+			case reviewHelpCommand:
+				_, _ = fmt.Fprint(out, reviewHelp)
+				continue
+			case reviewSkip:
+			}
+
+			break
+		}
+	}
+
+	return reviews, nil
+}
+
+// parseReviewCommand разбирает команду интерактивного режима для группы group
+func parseReviewCommand(line string, group duplicate.Group) (reviewCommand, duplicate.Review, duplicate.KeepPolicy, error) {
+	switch {
+	case line == "":
+		review, err := duplicate.NewReview(group, []int{0})
+		return reviewKeep, review, nil, err
+	case line == "s":
+		return reviewSkip, duplicate.Review{}, nil, nil
+	case line == "q":
+		return reviewQuit, duplicate.Review{}, nil, nil
+	case line == "?":
+		return reviewHelpCommand, duplicate.Review{}, nil, nil
+	case line == "a":
+		return reviewAll, duplicate.Review{}, nil, nil
+	case strings.HasPrefix(line, "a "):
+		policies, err := parseKeepPolicies(strings.Fields(line[2:]))
+		if err != nil {
+			return 0, duplicate.Review{}, nil, err
+		}
+
+		return reviewAll, duplicate.Review{}, duplicate.KeepPolicies(policies), nil
+	}
+
+	fields := strings.FieldsFunc(line, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	keep := make([]int, len(fields))
+	for ind, field := range fields {
+		number, err := strconv.Atoi(field)
+		if err != nil {
+			return 0, duplicate.Review{}, nil, fmt.Errorf("%q: %w", line, errUnknownReviewCommand)
+		}
+		if number < 1 || number > len(group.Files) {
+			return 0, duplicate.Review{}, nil, fmt.Errorf("%d: %w", number, errUnknownFileNumber)
+		}
+		keep[ind] = number - 1
+	}
+
+	review, err := duplicate.NewReview(group, keep)
+	return reviewKeep, review, nil, err
+}
+
+// reviewByRule создает решение по группе правилом rule. Без правила остается предложенный файл.
+func reviewByRule(group duplicate.Group, rule duplicate.KeepPolicy) duplicate.Review {
+	if rule == nil {
+		review, _ := duplicate.NewReview(group, []int{0})
+		return review
+	}
+
+	return duplicate.ReviewByPolicy(group, rule)
+}
+
+// printGroup выводит группу дубликатов с номерами файлов, размером и временем изменения
+func printGroup(out io.Writer, number, total int, group duplicate.Group) {
+	_, _ = fmt.Fprintf(out, "\nГруппа %d из %d: %s, освободится %s\n",
+		number, total, group.Key, duplicate.FormatBytes(group.WastedBytes()))
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for ind, file := range group.Files {
+		mark := " "
+		if ind == 0 {
+			mark = "*"
+		}
+
+		name := file.Path
+		if file.Symlink {
+			name += " (символическая ссылка)"
+		}
+		_, _ = fmt.Fprintf(w, "%3d%s\t%s\t%s\t%s\n", ind+1, mark, name, duplicate.FormatBytes(file.Size),
+			file.ModTime.Local().Format("2006-01-02 15:04:05"))
+	}
+	_ = w.Flush()
+}
+
+// printReviews выводит итог интерактивного просмотра
+func printReviews(out io.Writer, reviews map[string]duplicate.Review) {
+	var duplicates int
+	var wasted int64
+	for _, review := range reviews {
+		duplicates += len(review.Duplicates)
+		wasted += review.WastedBytes()
+	}
+
+	_, _ = fmt.Fprintf(out, "\nОдобрено групп: %d, дубликатов: %d, освободится %s\n", len(reviews), duplicates, duplicate.FormatBytes(wasted))
+}
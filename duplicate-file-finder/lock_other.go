@@ -0,0 +1,44 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// errLocked Ошибка, обозначающая что файл блокировки не освободился за lockTimeout
+var errLocked = errors.New("lock file is held by another run, remove it if no other run is active")
+
+// lockTimeout время ожидания освобождения файла блокировки
+const lockTimeout = 30 * time.Second
+
+// lockRetry интервал между попытками создать файл блокировки
+const lockRetry = 100 * time.Millisecond
+
+// lockFile создает файл блокировки lockPath, дожидаясь, пока его удалит другой процесс.
+// Возвращает функцию снятия блокировки, которая удаляет файл.
+func lockFile(lockPath string) (func(), error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, lockPerm)
+		if err == nil {
+			_ = file.Close()
+			return func() {
+				_ = os.Remove(lockPath)
+			}, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s: %w", lockPath, errLocked)
+		}
+
+		time.Sleep(lockRetry)
+	}
+}
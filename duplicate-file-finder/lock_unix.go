@@ -0,0 +1,27 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile берет эксклюзивную блокировку flock на файл lockPath, дожидаясь, пока ее снимет другой процесс.
+// Возвращает функцию снятия блокировки. Блокировка снимается и при завершении процесса.
+func lockFile(lockPath string) (func(), error) {
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, lockPerm)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		_ = file.Close()
+		return nil, &os.PathError{Op: "flock", Path: lockPath, Err: err}
+	}
+
+	return func() {
+		_ = file.Close()
+	}, nil
+}
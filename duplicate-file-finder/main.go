@@ -2,9 +2,14 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
 	"strings"
 
 	"go.uber.org/zap"
@@ -13,48 +18,726 @@ import (
 )
 
 var isRemove = flag.Bool("remove", false, "удалять дубликаты файлов")
-var startDir = flag.String("path", ".", "Стартовая директория для поиска")
+var startDir = flag.String("path", ".", "Стартовая директория для поиска. Несколько стартовых директорий "+
+	"можно указать аргументами после флагов: finder [флаги] DIR...")
 var maxDepth = flag.Int("maxdepth", 0, "максимальная глубина поиска по подкаталогам. --maxdepth <= 0 нет ограничений на вложенность")
+var verify = flag.Bool("verify", false, "побайтово сравнивать каждый дубликат с оставляемым файлом перед удалением")
+var actionName = flag.String("action", "", "действие над дубликатами: remove - удалить, hardlink - заменить жесткой ссылкой, "+
+	"symlink - заменить символической ссылкой, reflink - заменить copy-on-write клоном оставляемого файла, "+
+	"quarantine - переместить в директорию карантина --trash. -remove равносилен --action=remove")
+var trashDir = flag.String("trash", ".duplicates-trash", "директория карантина для --action=quarantine и команды restore")
+var journalPath = flag.String("journal", "", "файл журнала, в который дописываются все действия над дубликатами. "+
+	"Журнал используется командой undo")
+var relativeSymlinks = flag.Bool("relative-symlinks", false, "при --action=symlink создавать ссылки относительно директории дубликата")
+var matchMode = flag.String("match", "name", "способ сравнения файлов: name - имя и размер, content - SHA-256 содержимого")
+var scriptPath = flag.String("script", "", "вместо выполнения действия записать в файл POSIX shell-скрипт, "+
+	"который выполняет --action над дубликатами. \"-\" - вывести скрипт в стандартный вывод")
+var planPath = flag.String("plan", "-", "файл, в который команда plan записывает план обработки дубликатов "+
+	"действием --action. \"-\" - вывести план в стандартный вывод")
+var outputFormat = flag.String("format", "table", "формат вывода найденных дубликатов: table, json, jsonl, csv, fdupes")
+
+var cachePath = flag.String("cache", "", "файл кэша хэшей для --match=content. Хэши неизменившихся файлов "+
+	"берутся из кэша, записи исчезнувших файлов удаляются из него в конце работы")
+var showProgress = flag.Bool("progress", true, "показывать ход работы. Не показывается, если вывод не в терминал "+
+	"или формат вывода машиночитаемый")
+var interactive = flag.Bool("interactive", false, "просмотреть группы дубликатов по одной, начиная с самых больших, "+
+	"и выбрать, какие файлы оставить. Действие --action выполняется только над одобренными группами")
+var summaryTop = flag.Int("top", duplicate.DefaultSummaryTop, "количество групп и директорий с наибольшим объемом дубликатов в сводке")
+var jobs = flag.Int("jobs", runtime.GOMAXPROCS(0), "количество одновременно читаемых директорий")
+var hashJobs = flag.Int("hash-jobs", runtime.GOMAXPROCS(0), "количество одновременно хэшируемых файлов при --match=content")
+
+var keepPolicies = stringListFlag("keep", "правило выбора оставляемого файла: shortest, oldest, newest, lexical, "+
+	"glob:ШАБЛОН, regex:ВЫРАЖЕНИЕ, dir:ДИРЕКТОРИЯ, root:СТАРТОВАЯ_ДИРЕКТОРИЯ. "+
+	"Флаг можно указать несколько раз, правила применяются по очереди")
+var includePatterns = stringListFlag("include", "учитывать только файлы, подходящие под glob-шаблон (** - любое количество директорий). "+
+	"Шаблон без / сравнивается с именем файла, иначе - с путем относительно стартовой директории. Флаг можно указать несколько раз")
+var excludePatterns = stringListFlag("exclude", "пропускать файлы и директории, подходящие под glob-шаблон, "+
+	"например .git или **/node_modules. Флаг можно указать несколько раз")
+var extensions = stringListFlag("ext", "учитывать только файлы с расширением. Флаг можно указать несколько раз")
+var excludeExtensions = stringListFlag("exclude-ext", "пропускать файлы с расширением. Флаг можно указать несколько раз")
+var minSize = sizeFlag("min-size", "минимальный размер файла, например 512, 10K, 1M")
+var maxSize = sizeFlag("max-size", "максимальный размер файла, например 512, 10K, 1M. 0 - без ограничения")
+var skipHidden = flag.Bool("skip-hidden", false, "пропускать файлы и директории, имя которых начинается с точки")
+var followSymlinks = flag.Bool("follow-symlinks", false, "переходить по символическим ссылкам на файлы и директории. "+
+	"Каждая директория читается один раз, зацикленные ссылки пропускаются. Ссылка на оставляемый файл не считается дубликатом")
+var findDirs = flag.Bool("dirs", false, "искать одинаковые директории и директории, каждый файл которых есть в другой директории. "+
+	"С -remove или --action=remove такие директории удаляются целиком. Без --match=content перед удалением "+
+	"каждый файл директории побайтово сравнивается с файлом остающейся директории")
+var useIgnoreFiles = flag.Bool("gitignore", false, "учитывать правила из файлов .gitignore и .ignore, найденных при поиске")
+
+// scriptPerm права файла, в который записывается shell-скрипт
+const scriptPerm = 0755
+
+// exitUsage код выхода при неверных флагах или аргументах команды
+const exitUsage = 2
+
+// errActionConflict Ошибка одновременного указания -remove и другого действия в --action
+var errActionConflict = errors.New("flag -remove conflicts with --action")
+
+// errDirsConflict Ошибка указания флага --dirs с режимом или действием, которые обрабатывают дубликаты по одному файлу
+var errDirsConflict = errors.New("flag --dirs supports only remove action and conflicts with --script, --interactive, tui and plan")
+
+// confirmDirsMessage вопрос подтверждения удаления директорий-дубликатов
+const confirmDirsMessage = "Удалить директории-дубликаты(Y/n): "
+
+// confirmMessages вопросы подтверждения для каждого действия над дубликатами
+var confirmMessages = map[string]string{
+	duplicate.RemoveAction{}.String():     "Удалить дубликаты(Y/n): ",
+	duplicate.HardlinkAction{}.String():   "Заменить дубликаты жесткими ссылками(Y/n): ",
+	duplicate.SymlinkAction{}.String():    "Заменить дубликаты символическими ссылками(Y/n): ",
+	duplicate.ReflinkAction{}.String():    "Заменить дубликаты copy-on-write клонами(Y/n): ",
+	duplicate.QuarantineAction{}.String(): "Переместить дубликаты в карантин(Y/n): ",
+}
+
+// commands подкоманды поиска дубликатов, которые указываются первым аргументом
+var commands = map[string]func(args []string) int{
+	"restore": runRestore,
+	"undo":    runUndo,
+	"tui":     runTUI,
+	"plan":    runPlan,
+	"apply":   runApply,
+	"subset":  runCompare,
+	"diff":    runCompare,
+}
+
+// searchMode режим работы команды поиска дубликатов
+type searchMode int
+
+// Режимы работы команды поиска дубликатов
+const (
+	// modeFind вывести найденные дубликаты и выполнить над ними действие
+	modeFind searchMode = iota
+	// modeTUI показать найденные дубликаты в полноэкранном интерфейсе
+	modeTUI
+	// modePlan записать план обработки найденных дубликатов
+	modePlan
+)
+
+// actionPlan описывает действие над дубликатами. Если reviews равен nil, действие выполняется над всеми дубликатами,
+// иначе только над дубликатами из решений reviews. Если dirs равен true, директории-дубликаты удаляются целиком.
+type actionPlan struct {
+	action  duplicate.Action
+	reviews map[string]duplicate.Review
+	dirs    bool
+}
 
 func main() {
-	flag.Parse()
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
+	os.Exit(run(os.Args[1:], modeFind))
+}
+
+// runTUI ищет дубликаты с флагами args и показывает их в полноэкранном интерфейсе, в котором
+// файлы помечаются для удаления или замены жесткой ссылкой. Возвращает код выхода программы.
+func runTUI(args []string) int {
+	return run(args, modeTUI)
+}
+
+// runPlan ищет дубликаты с флагами args и записывает план их обработки в файл --plan. Возвращает код выхода программы.
+func runPlan(args []string) int {
+	return run(args, modePlan)
+}
+
+// searchConfig описывает проверенные флаги команды поиска дубликатов
+type searchConfig struct {
+	mode      searchMode
+	roots     []string
+	match     duplicate.MatchMode
+	formatter duplicate.Formatter
+	action    duplicate.Action
+	isAction  bool
+	filter    duplicate.Filter
+	keep      []duplicate.KeepPolicy
+}
 
-	logger, _ := zap.NewProduction()
+// search описывает выполненный поиск дубликатов, с результатом которого работает режим команды.
+// Если bar равен nil, ход работы не показывается.
+type search struct {
+	*searchConfig
+	finder    *duplicate.Duplicates
+	logger    *zap.Logger
+	bar       *progressBar
+	result    *duplicate.SeekResult
+	hasErrors bool
+}
+
+// run ищет дубликаты с флагами args и в режиме mode выводит их, показывает в полноэкранном интерфейсе
+// или записывает план их обработки. Возвращает код выхода программы.
+func run(args []string, mode searchMode) int {
+	_ = flag.CommandLine.Parse(args)
+	config, err := parseSearchFlags(mode)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if quarantine, ok := config.action.(duplicate.QuarantineAction); ok && config.isAction && mode == modeFind {
+		var manifest io.Closer
+		config.action, manifest, err = openQuarantine(quarantine, *trashDir, config.roots)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer func() {
+			_ = manifest.Close()
+		}()
+	}
+
+	// Индикатор хода работы выводится в stderr вместе с логами, поэтому при нем логируются только предупреждения и ошибки
+	bar := newProgressBar(*showProgress, config.formatter)
+	logger := newLogger(bar != nil || mode == modeTUI)
 	defer func() {
 		err := logger.Sync()
 		if err != nil {
-			fmt.Println(err)
+			_, _ = fmt.Fprintln(os.Stderr, err)
 		}
 	}()
 
-	logger = logger.With(zap.String("startSearchingDir", *startDir))
-	logger = logger.With(zap.Int("searchingDepth", *maxDepth))
-	logger = logger.With(zap.Bool("isRemove", *isRemove))
+	logger = logger.With(
+		zap.Strings("startSearchingDirs", config.roots),
+		zap.Int("searchingDepth", *maxDepth),
+		zap.Bool("isAction", config.isAction),
+		zap.Stringer("action", config.action),
+		zap.Stringer("match", config.match),
+		zap.Bool("verify", *verify),
+		zap.Strings("keep", *keepPolicies),
+	)
 
-	fs := &duplicate.FileSystem{}
-	finder := duplicate.NewDuplicateFinder(fs, logger)
-	logger.Info("Start searching...")
-	files := finder.Seek(*startDir, *maxDepth)
+	finder, closeFinder, err := newFinder(config, logger, bar)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeFinder()
+
+	s := &search{searchConfig: config, finder: finder, logger: logger, bar: bar}
+	s.seek()
+	defer s.printStats()
+
+	var plans []actionPlan
+	var code int
+	switch {
+	case *scriptPath != "":
+		return s.script()
+	case mode == modePlan:
+		return s.plan()
+	case mode == modeTUI:
+		plans, code = s.tuiPlans()
+	case *interactive:
+		plans, code = s.reviewPlans(bufio.NewReader(os.Stdin))
+	case *findDirs:
+		plans, code = s.dirsPlans(bufio.NewReader(os.Stdin))
+	default:
+		plans, code = s.actionPlans(bufio.NewReader(os.Stdin))
+	}
+	if len(plans) == 0 {
+		return code
+	}
+
+	return s.apply(plans)
+}
+
+// parseSearchFlags разбирает и проверяет флаги команды поиска дубликатов в режиме mode
+func parseSearchFlags(mode searchMode) (*searchConfig, error) {
+	match, err := duplicate.ParseMatchMode(*matchMode)
+	if err != nil {
+		return nil, err
+	}
+
+	formatter, err := duplicate.ParseFormat(*outputFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	action, isAction, err := parseAction()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := duplicate.Filter{
+		Include:           *includePatterns,
+		Exclude:           *excludePatterns,
+		MinSize:           int64(*minSize),
+		MaxSize:           int64(*maxSize),
+		Extensions:        *extensions,
+		ExcludeExtensions: *excludeExtensions,
+		SkipHidden:        *skipHidden,
+		IgnoreFiles:       *useIgnoreFiles,
+	}
+	if err = filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err = checkActionConflicts(mode, action, isAction); err != nil {
+		return nil, err
+	}
+	if err = checkModeConflicts(mode, isAction); err != nil {
+		return nil, err
+	}
+
+	keep, err := parseKeepPolicies(*keepPolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &searchConfig{
+		mode:      mode,
+		roots:     searchRoots(),
+		match:     match,
+		formatter: formatter,
+		action:    action,
+		isAction:  isAction,
+		filter:    filter,
+		keep:      keep,
+	}, nil
+}
+
+// checkActionConflicts проверяет, что действие action можно выполнить в режиме mode с остальными флагами
+func checkActionConflicts(mode searchMode, action duplicate.Action, isAction bool) error {
+	if *interactive && *scriptPath != "" {
+		return errInteractiveScript
+	}
+	if *interactive && !isAction {
+		return errInteractiveWithoutAction
+	}
+
+	if *findDirs && (mode != modeFind || *scriptPath != "" || *interactive || action.String() != duplicate.RemoveAction{}.String()) {
+		return errDirsConflict
+	}
+
+	if _, ok := action.(duplicate.QuarantineAction); ok && *scriptPath != "" {
+		return fmt.Errorf("%s: %w", action, duplicate.ErrActionNotScriptable)
+	}
 
-	logger.Info("Printing searched results...")
-	finder.PrintDuplicates(os.Stdout)
+	return nil
+}
 
-	if *isRemove && len(files) > 0 {
-		var removeConfirm string
-		fmt.Print("Удалить дубликаты(Y/n): ")
-		_, err := fmt.Scanln(&removeConfirm)
+// checkModeConflicts проверяет, что режим mode можно использовать с остальными флагами
+func checkModeConflicts(mode searchMode, isAction bool) error {
+	switch mode {
+	case modeTUI:
+		if isAction || *scriptPath != "" || *interactive {
+			return errTUIConflict
+		}
+		if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+			return errTUINotTerminal
+		}
+	case modePlan:
+		if *scriptPath != "" || *interactive {
+			return errPlanConflict
+		}
+	case modeFind:
+	}
+
+	return nil
+}
+
+// newFinder создает поиск дубликатов с проверенными флагами config. Возвращаемая функция закрывает журнал
+// и сохраняет кэш хэшей, ее нужно вызвать после обработки дубликатов.
+func newFinder(config *searchConfig, logger *zap.Logger, bar *progressBar) (*duplicate.Duplicates, func(), error) {
+	opts := []duplicate.Option{
+		duplicate.WithMatch(config.match),
+		duplicate.WithVerify(*verify),
+		duplicate.WithKeepPolicy(config.keep...),
+		duplicate.WithFilter(config.filter),
+		duplicate.WithJobs(*jobs),
+		duplicate.WithHashJobs(*hashJobs),
+		duplicate.WithFollowSymlinks(*followSymlinks),
+		duplicate.WithSummaryTop(*summaryTop),
+		duplicate.WithDirs(*findDirs),
+	}
+	if bar != nil {
+		opts = append(opts, duplicate.WithProgress(progressInterval, bar.update))
+	}
+
+	var closers []func()
+	closeAll := func() {
+		for ind := len(closers) - 1; ind >= 0; ind-- {
+			closers[ind]()
+		}
+	}
+
+	if *journalPath != "" {
+		journal, closer, err := openJournal(*journalPath)
 		if err != nil {
-			logger.Error("Can't scan removing confirm message")
+			logger.Error("Can't open journal " + *journalPath)
+			return nil, nil, err
+		}
+		closers = append(closers, func() {
+			_ = closer.Close()
+		})
+
+		opts = append(opts, duplicate.WithJournal(journal))
+	}
+
+	fs := &duplicate.FileSystem{}
+	if *cachePath != "" {
+		cache, err := openHashCache(*cachePath)
+		if err != nil {
+			logger.Error("Can't open hash cache " + *cachePath)
+			closeAll()
+			return nil, nil, err
+		}
+		closers = append(closers, func() {
+			if saveErr := saveHashCache(*cachePath, cache, fs); saveErr != nil {
+				logger.Error("Can't save hash cache " + *cachePath)
+				_, _ = fmt.Fprintln(os.Stderr, saveErr)
+			}
+		})
+
+		opts = append(opts, duplicate.WithHashCache(cache))
+	}
+
+	return duplicate.NewDuplicateFinder(fs, logger, opts...), closeAll, nil
+}
+
+// seek ищет дубликаты в стартовых директориях и выводит ошибки поиска
+func (s *search) seek() {
+	s.logger.Info("Start searching...")
+	ctx, stop := interruptContext(s.logger)
+	s.result = s.finder.SeekRootsContext(ctx, s.roots, *maxDepth)
+	stop()
+	if s.bar != nil {
+		s.bar.finish()
+	}
+	if s.result.Incomplete {
+		s.logger.Warn("Search was interrupted, found duplicates are incomplete")
+	}
+	s.hasErrors = reportErrors("Поиск", s.result.Errors)
+}
+
+// printStats выводит в stderr объем работы этапов поиска по содержимому. Статистика выводится напрямую, а не в лог,
+// потому что при индикаторе хода работы логируются только предупреждения и ошибки
+func (s *search) printStats() {
+	if s.match != duplicate.MatchContent {
+		return
+	}
+
+	stats := s.finder.Stats()
+	_, _ = fmt.Fprintf(os.Stderr, "Этапы поиска: по размеру файлов %d, частичный хэш файлов %d (%s), полный хэш файлов %d (%s)\n",
+		stats.Size.Files, stats.Partial.Files, duplicate.FormatBytes(stats.Partial.Bytes),
+		stats.Full.Files, duplicate.FormatBytes(stats.Full.Bytes))
+}
+
+// script записывает shell-скрипт с действием над найденными дубликатами в файл --script. Возвращает код выхода программы.
+func (s *search) script() int {
+	s.logger.Info("Writing script...", zap.String("script", *scriptPath))
+	if err := writeScript(*scriptPath, s.finder, s.action); err != nil {
+		s.logger.Error("Can't write script " + *scriptPath)
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return exitCode(s.result.Incomplete, s.hasErrors)
+}
+
+// plan записывает план обработки найденных дубликатов в файл --plan. Возвращает код выхода программы.
+func (s *search) plan() int {
+	if s.result.Incomplete {
+		return exitCode(true, s.hasErrors)
+	}
+
+	s.logger.Info("Writing plan...", zap.String("plan", *planPath))
+	ctx, stop := interruptContext(s.logger)
+	defer stop()
+	planErrors, err := writePlan(ctx, *planPath, s.finder, s.action, s.roots)
+	if err != nil {
+		s.logger.Error("Can't write plan " + *planPath)
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return exitCode(ctx.Err() != nil, true)
+	}
+
+	return exitCode(false, s.hasErrors || planErrors)
+}
+
+// tuiPlans показывает найденные дубликаты в полноэкранном интерфейсе и возвращает выбранные в нем действия.
+// Если действий нет, возвращает код выхода программы.
+func (s *search) tuiPlans() ([]actionPlan, int) {
+	if len(s.result.Files) == 0 || s.result.Incomplete {
+		_, _ = fmt.Fprintln(os.Stdout, "Дубликаты не найдены")
+		return nil, exitCode(s.result.Incomplete, s.hasErrors)
+	}
+
+	plans, err := browseGroups(os.Stdin, os.Stdout, s.finder.Report().Groups)
+	if err != nil {
+		s.logger.Error("Can't show terminal UI")
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return nil, 1
+	}
+
+	return plans, exitCode(false, s.hasErrors)
+}
+
+// reviewPlans просматривает группы дубликатов по одной и после подтверждения возвращает действие
+// над одобренными группами. Если действия нет, возвращает код выхода программы.
+func (s *search) reviewPlans(stdin *bufio.Reader) ([]actionPlan, int) {
+	if len(s.result.Files) == 0 || s.result.Incomplete {
+		return nil, exitCode(s.result.Incomplete, s.hasErrors)
+	}
+
+	reviews, err := reviewGroups(stdin, os.Stdout, s.finder.Report().Groups)
+	if err != nil {
+		s.logger.Error("Can't read review command")
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return nil, 1
+	}
+
+	printReviews(os.Stdout, reviews)
+	if len(reviews) == 0 {
+		return nil, exitCode(false, s.hasErrors)
+	}
+
+	plan := actionPlan{action: s.action, reviews: reviews}
+	return s.confirmPlan(stdin, plan, true, confirmMessages[s.action.String()])
+}
+
+// dirsPlans выводит найденные директории-дубликаты и после подтверждения возвращает их удаление.
+// Если действия нет, возвращает код выхода программы.
+func (s *search) dirsPlans(stdin *bufio.Reader) ([]actionPlan, int) {
+	if !s.printResults() {
+		return nil, 1
+	}
+
+	found := len(s.result.Dirs)+len(s.result.Subsets) > 0
+	return s.confirmPlan(stdin, actionPlan{action: s.action, dirs: true}, found, confirmDirsMessage)
+}
+
+// actionPlans выводит найденные дубликаты и после подтверждения возвращает действие --action над всеми дубликатами.
+// Если действия нет, возвращает код выхода программы.
+func (s *search) actionPlans(stdin *bufio.Reader) ([]actionPlan, int) {
+	if !s.printResults() {
+		return nil, 1
+	}
+
+	found := len(s.result.Files) > 0
+	return s.confirmPlan(stdin, actionPlan{action: s.action}, found, confirmMessages[s.action.String()])
+}
+
+// printResults выводит найденные дубликаты в формате --format. Если формат не может вывести сводку,
+// не нарушив структуру строк, сводка выводится в stderr. Возвращает false, если вывести дубликаты не удалось.
+func (s *search) printResults() bool {
+	s.logger.Info("Printing searched results...")
+	if err := s.finder.WriteDuplicates(os.Stdout, s.formatter); err != nil {
+		s.logger.Error("Can't print searched results")
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+
+	if !duplicate.HasSummary(s.formatter) {
+		if err := s.finder.WriteSummary(os.Stderr); err != nil {
 			_, _ = fmt.Fprintln(os.Stderr, err)
-			return
+		}
+	}
+
+	return true
+}
+
+// confirmPlan задает вопрос message и, если действие подтверждено, возвращает план plan. Вопрос задается,
+// только если действие указано флагами, дубликаты найдены и поиск не прерван. Иначе возвращает код выхода программы.
+func (s *search) confirmPlan(stdin *bufio.Reader, plan actionPlan, found bool, message string) ([]actionPlan, int) {
+	if !s.isAction || !found || s.result.Incomplete {
+		return nil, exitCode(s.result.Incomplete, s.hasErrors)
+	}
+
+	confirmed, err := confirmAction(stdin, s.formatter, message)
+	if err != nil {
+		s.logger.Error("Can't scan action confirm message")
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return nil, 1
+	}
+	if !confirmed {
+		return nil, exitCode(false, s.hasErrors)
+	}
+
+	return []actionPlan{plan}, 0
+}
+
+// apply выполняет действия plans над найденными дубликатами. Возвращает код выхода программы.
+func (s *search) apply(plans []actionPlan) int {
+	s.logger.Info("Processing files...")
+	ctx, stop := interruptContext(s.logger)
+	defer stop()
+	applied, err := applyPlans(ctx, s.finder, plans)
+	if err != nil {
+		s.logger.Error("Can't apply reviewed duplicates")
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if s.bar != nil {
+		s.bar.finish()
+	}
+	applyErrors := reportApplied(s.logger, applied)
+
+	return exitCode(applied.Incomplete, s.hasErrors || applyErrors)
+}
+
+// reportApplied выводит пропущенные файлы и ошибки обработки дубликатов. Возвращает true, если ошибки были.
+func reportApplied(logger *zap.Logger, applied *duplicate.RemoveResult) bool {
+	for _, skipped := range applied.Skipped {
+		logger.Warn("File was not processed",
+			zap.String("path", skipped.File.Path),
+			zap.String("kept", skipped.Kept.Path),
+			zap.Error(skipped.Reason),
+		)
+	}
+
+	if applied.Incomplete {
+		logger.Warn("Processing was interrupted, some duplicates were not processed")
+	}
+
+	return reportErrors("Обработка дубликатов", applied.Errors)
+}
+
+// applyPlans выполняет действия plans по очереди, пока не отменен контекст ctx, и объединяет их результаты
+func applyPlans(ctx context.Context, finder *duplicate.Duplicates, plans []actionPlan) (*duplicate.RemoveResult, error) {
+	applied := &duplicate.RemoveResult{}
+	for _, plan := range plans {
+		var step *duplicate.RemoveResult
+		switch {
+		case plan.dirs:
+			step = finder.RemoveDirsContext(ctx)
+		case plan.reviews == nil:
+			step = finder.ApplyAllDuplicatesContext(ctx, plan.action)
+		default:
+			var err error
+			if step, err = finder.ApplyReviewedContext(ctx, plan.action, plan.reviews); err != nil {
+				return nil, err
+			}
 		}
 
-		removeConfirm = strings.ToLower(strings.TrimSpace(removeConfirm))
-		if removeConfirm != "y" && removeConfirm != "yes" {
-			return
+		applied.Removed = append(applied.Removed, step.Removed...)
+		applied.Skipped = append(applied.Skipped, step.Skipped...)
+		applied.Errors = append(applied.Errors, step.Errors...)
+		if step.Incomplete {
+			applied.Incomplete = true
+			break
 		}
+	}
+
+	return applied, nil
+}
+
+// searchRoots возвращает стартовые директории поиска: аргументы после флагов и --path, если он указан явно.
+// Без аргументов поиск идет только в --path.
+func searchRoots() []string {
+	if flag.NArg() == 0 {
+		return []string{*startDir}
+	}
+
+	roots := flag.Args()
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "path" {
+			roots = append([]string{*startDir}, roots...)
+		}
+	})
+
+	return roots
+}
+
+// exitCode возвращает код выхода программы: прерывание сигналом важнее ошибок
+func exitCode(interrupted, hasErrors bool) int {
+	switch {
+	case interrupted:
+		return exitInterrupted
+	case hasErrors:
+		return exitErrors
+	}
+
+	return 0
+}
+
+// confirmAction задает вопрос message и читает подтверждение действия над дубликатами
+func confirmAction(in io.Reader, formatter duplicate.Formatter, message string) (bool, error) {
+	// Вопрос подтверждения не должен попадать в машиночитаемый вывод
+	prompt := io.Writer(os.Stdout)
+	if _, ok := formatter.(duplicate.TableFormatter); !ok {
+		prompt = os.Stderr
+	}
+	_, _ = fmt.Fprint(prompt, message)
 
-		logger.Info("Removing files...")
-		finder.RemoveAllDuplicates()
+	var actionConfirm string
+	if _, err := fmt.Fscanln(in, &actionConfirm); err != nil {
+		return false, err
 	}
+
+	actionConfirm = strings.ToLower(strings.TrimSpace(actionConfirm))
+	return actionConfirm == "y" || actionConfirm == "yes", nil
+}
+
+// newLogger создает логгер. Если quiet равен true, логируются только предупреждения и ошибки.
+func newLogger(quiet bool) *zap.Logger {
+	config := zap.NewProductionConfig()
+	if quiet {
+		config.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
+	}
+
+	logger, _ := config.Build()
+	return logger
+}
+
+// parseAction возвращает выбранное действие над дубликатами и признак того, что его нужно выполнить
+func parseAction() (duplicate.Action, bool, error) {
+	if *actionName == "" {
+		return duplicate.RemoveAction{}, *isRemove, nil
+	}
+
+	action, err := duplicate.ParseAction(*actionName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if _, ok := action.(duplicate.RemoveAction); *isRemove && !ok {
+		return nil, false, fmt.Errorf("%w=%s", errActionConflict, action)
+	}
+
+	if symlink, ok := action.(duplicate.SymlinkAction); ok {
+		symlink.Relative = *relativeSymlinks
+		action = symlink
+	}
+
+	return action, true, nil
+}
+
+// parseKeepPolicies разбирает правила выбора оставляемого файла из флагов --keep
+func parseKeepPolicies(specs []string) ([]duplicate.KeepPolicy, error) {
+	policies := make([]duplicate.KeepPolicy, 0, len(specs))
+	for _, spec := range specs {
+		policy, err := duplicate.ParseKeepPolicy(spec)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// writeScript записывает shell-скрипт с действием action над найденными дубликатами в файл scriptPath.
+// Скрипт переходит в текущую рабочую директорию, относительно которой записаны пути.
+func writeScript(scriptPath string, finder *duplicate.Duplicates, action duplicate.Action) error {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	formatter := duplicate.ScriptFormatter{Action: action, Dir: workDir}
+	if scriptPath == "-" {
+		return finder.WriteDuplicates(os.Stdout, formatter)
+	}
+
+	file, err := os.OpenFile(scriptPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, scriptPerm)
+	if err != nil {
+		return err
+	}
+
+	err = finder.WriteDuplicates(file, formatter)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"github.com/phpCoder88/geekbrains-go2/duplicate-file-finder/duplicate"
+)
+
+// errPlanConflict Ошибка одновременного указания команды plan и флагов, выполняющих действие над дубликатами
+var errPlanConflict = errors.New("plan conflicts with --script and --interactive")
+
+// writePlan записывает в файл planPath план обработки найденных дубликатов действием action и выводит его сводку в stderr.
+// "-" - вывести план в стандартный вывод. Возвращает true, если часть групп не попала в план из-за ошибок хэширования.
+func writePlan(ctx context.Context, planPath string, finder *duplicate.Duplicates, action duplicate.Action, roots []string) (bool, error) {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return false, err
+	}
+
+	plan, planErr := finder.PlanContext(ctx, action, roots, workDir)
+	if plan == nil {
+		return false, planErr
+	}
+	if planErr != nil {
+		_, _ = fmt.Fprintln(os.Stderr, planErr)
+	}
+
+	if planPath == "-" {
+		err = plan.Write(os.Stdout)
+	} else {
+		err = writeFileAtomic(planPath, plan.Write)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var duplicates int
+	for _, group := range plan.Groups {
+		duplicates += len(group.Duplicates)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "План: %s, групп %d, дубликатов %d, освободится %s\n",
+		plan.Action, len(plan.Groups), duplicates, duplicate.FormatBytes(plan.ReclaimableBytes))
+
+	return planErr != nil, nil
+}
+
+// readPlan читает план обработки дубликатов из файла planPath
+func readPlan(planPath string) (*duplicate.Plan, error) {
+	file, err := os.Open(planPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return duplicate.ReadPlan(file)
+}
+
+// runApply команда apply: сверяет файлы плана с записанным состоянием и, только если ни один файл не изменился,
+// выполняет записанное в плане действие
+func runApply(args []string) int {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	planFile := flags.String("plan", "", "файл плана, записанный командой plan")
+	verifyContent := flags.Bool("verify", false, "побайтово сравнивать каждый дубликат с оставляемым файлом перед обработкой")
+	journalFile := flags.String("journal", "", "файл журнала, в который дописываются все действия над дубликатами")
+	trash := flags.String("trash", ".duplicates-trash", "директория карантина для плана с действием quarantine")
+	_ = flags.Parse(args)
+
+	if *planFile == "" {
+		flags.Usage()
+		return exitUsage
+	}
+
+	plan, err := readPlan(*planFile)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	action, err := plan.ParseAction()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if quarantine, ok := action.(duplicate.QuarantineAction); ok {
+		roots := make([]string, len(plan.Roots))
+		for ind, root := range plan.Roots {
+			roots[ind] = plan.Path(root)
+		}
+
+		var manifest io.Closer
+		action, manifest, err = openQuarantine(quarantine, *trash, roots)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer func() {
+			_ = manifest.Close()
+		}()
+	}
+
+	logger := newLogger(false)
+	defer func() {
+		_ = logger.Sync()
+	}()
+	logger = logger.With(zap.String("plan", *planFile), zap.Stringer("action", action))
+
+	opts := []duplicate.Option{duplicate.WithVerify(*verifyContent)}
+	if *journalFile != "" {
+		journal, closer, err := openJournal(*journalFile)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer func() {
+			_ = closer.Close()
+		}()
+
+		opts = append(opts, duplicate.WithJournal(journal))
+	}
+
+	finder := duplicate.NewDuplicateFinder(&duplicate.FileSystem{}, logger, opts...)
+	logger.Info("Validating and applying plan...")
+	ctx, stop := interruptContext(logger)
+	defer stop()
+	applied, err := finder.ApplyPlanContext(ctx, plan, action)
+	if errors.Is(err, duplicate.ErrPlanMismatch) {
+		reportErrors("Сверка с планом", applied.Errors)
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %v, план не выполнен\n", filepath.Base(*planFile), err)
+		return exitCode(applied.Incomplete, true)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, file := range applied.Removed {
+		fmt.Printf("%s %s\n", action, file.Path)
+	}
+
+	return exitCode(applied.Incomplete, reportApplied(logger, applied))
+}
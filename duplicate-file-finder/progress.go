@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/phpCoder88/geekbrains-go2/duplicate-file-finder/duplicate"
+)
+
+// progressInterval интервал обновления индикатора хода работы
+const progressInterval = 200 * time.Millisecond
+
+// progressBarWidth ширина полосы индикатора обработки дубликатов
+const progressBarWidth = 30
+
+// clearLine возвращает каретку в начало строки и стирает строку терминала
+const clearLine = "\r\033[K"
+
+// progressBar выводит ход работы одной обновляемой строкой терминала
+type progressBar struct {
+	out io.Writer
+}
+
+// newProgressBar возвращает индикатор хода работы в stderr или nil, если он выключен. Индикатор показывается,
+// только если вывод табличный, а stdout и stderr - терминалы.
+func newProgressBar(enabled bool, formatter duplicate.Formatter) *progressBar {
+	if _, isTable := formatter.(duplicate.TableFormatter); !enabled || !isTable {
+		return nil
+	}
+	if !isTerminal(os.Stdout) || !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	return &progressBar{out: os.Stderr}
+}
+
+// update перерисовывает строку хода работы
+func (b progressBar) update(progress duplicate.Progress) {
+	_, _ = fmt.Fprint(b.out, clearLine+formatProgress(progress))
+}
+
+// finish переводит строку, чтобы следующий вывод не затер последнее состояние
+func (b progressBar) finish() {
+	_, _ = fmt.Fprintln(b.out)
+}
+
+// formatProgress возвращает описание хода работы для этапа progress.Stage
+func formatProgress(progress duplicate.Progress) string {
+	switch progress.Stage {
+	case duplicate.ProgressScan:
+		return fmt.Sprintf("Поиск: директорий %d, файлов %d, групп %d", progress.Dirs, progress.Files, progress.Groups)
+	case duplicate.ProgressHash:
+		return fmt.Sprintf("Сравнение содержимого: файлов %d, прочитано %s, групп %d",
+			progress.Files, duplicate.FormatBytes(progress.HashedBytes), progress.Groups)
+	case duplicate.ProgressApply:
+		filled := 0
+		if progress.Duplicates > 0 {
+			filled = int(progress.Processed * progressBarWidth / progress.Duplicates)
+		}
+
+		return fmt.Sprintf("[%s%s] обработано %d из %d",
+			strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled), progress.Processed, progress.Duplicates)
+	}
+
+	return ""
+}
+
+// isTerminal проверяет, что файл является терминалом
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/phpCoder88/geekbrains-go2/duplicate-file-finder/duplicate"
+)
+
+// errTrashInsideSearchDir Ошибка расположения карантина внутри директории поиска
+var errTrashInsideSearchDir = errors.New("trash dir must be outside of searching dir")
+
+// trashDirPerm права директории карантина
+const trashDirPerm = 0700
+
+// openQuarantine готовит директорию карантина и открывает ее манифест на дозапись.
+// Карантин внутри любой из директорий поиска запрещен, иначе перемещенные файлы найдутся как дубликаты при следующем поиске.
+func openQuarantine(action duplicate.QuarantineAction, trash string, searchDirs []string) (duplicate.Action, io.Closer, error) {
+	trash, err := filepath.Abs(trash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, searchDir := range searchDirs {
+		searchDir, err = filepath.Abs(searchDir)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if trash == searchDir || strings.HasPrefix(trash, searchDir+string(filepath.Separator)) {
+			return nil, nil, fmt.Errorf("%s: %w", trash, errTrashInsideSearchDir)
+		}
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = os.MkdirAll(trash, trashDirPerm); err != nil {
+		return nil, nil, err
+	}
+
+	manifestPath := filepath.Join(trash, duplicate.QuarantineManifest)
+	manifest, err := os.OpenFile(manifestPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	action.Dir = trash
+	action.WorkDir = workDir
+	action.Manifest = duplicate.NewManifest(manifest)
+
+	return action, manifest, nil
+}
+
+// runRestore команда restore: возвращает файлы из карантина на исходные места
+func runRestore(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	trash := flags.String("trash", ".duplicates-trash", "директория карантина")
+	_ = flags.Parse(args)
+
+	manifestPath := filepath.Join(*trash, duplicate.QuarantineManifest)
+	entries, err := readManifest(manifestPath)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	result := duplicate.Restore(duplicate.FileSystem{}, entries)
+	for _, entry := range result.Restored {
+		fmt.Printf("restored %s\n", entry.Original)
+	}
+
+	remaining := make([]duplicate.QuarantineEntry, 0, len(result.Failed))
+	for _, failed := range result.Failed {
+		_, _ = fmt.Fprintf(os.Stderr, "not restored %s: %v\n", failed.Entry.Original, failed.Reason)
+		remaining = append(remaining, failed.Entry)
+	}
+
+	if err = writeManifest(manifestPath, remaining); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if len(result.Failed) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// readManifest читает записи манифеста карантина из файла
+func readManifest(manifestPath string) ([]duplicate.QuarantineEntry, error) {
+	manifest, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = manifest.Close()
+	}()
+
+	return duplicate.ReadManifest(manifest)
+}
+
+// writeManifest атомарно перезаписывает манифест карантина оставшимися записями
+func writeManifest(manifestPath string, entries []duplicate.QuarantineEntry) error {
+	return writeFileAtomic(manifestPath, func(w io.Writer) error {
+		manifest := duplicate.NewManifest(w)
+		for _, entry := range entries {
+			if err := manifest.Add(entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// writeFileAtomic записывает файл filePath функцией write во временный файл рядом с ним,
+// который затем переименовывается поверх filePath
+func writeFileAtomic(filePath string, write func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filePath), "."+filepath.Base(filePath))
+	if err != nil {
+		return err
+	}
+
+	if err = write(tmp); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filePath)
+}
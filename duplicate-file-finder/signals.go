@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// exitInterrupted код выхода при прерывании сигналом SIGINT или SIGTERM
+const exitInterrupted = 130
+
+// interruptContext возвращает контекст, который отменяется при получении SIGINT или SIGTERM.
+// После первого сигнала перехват снимается, поэтому повторный сигнал сразу завершает программу.
+// Возвращаемая функция отменяет контекст и снимает перехват сигналов.
+func interruptContext(logger *zap.Logger) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			logger.Warn("Interrupted, stopping...", zap.Stringer("signal", sig))
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// terminal терминал, переведенный в неканонический режим без эха для полноэкранного интерфейса
+type terminal struct {
+	fd    uintptr
+	state syscall.Termios
+}
+
+// winsize размер окна терминала, который возвращает ioctl TIOCGWINSZ
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+// openTerminal переводит терминал file в неканонический режим: нажатия клавиш читаются сразу, без эха и
+// обработки Ctrl-C. Исходный режим восстанавливает restore.
+func openTerminal(file *os.File) (*terminal, error) {
+	t := &terminal{fd: file.Fd()}
+	if err := t.ioctl(syscall.TCGETS, unsafe.Pointer(&t.state)); err != nil {
+		return nil, err
+	}
+
+	raw := t.state
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := t.ioctl(syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// size возвращает ширину и высоту терминала в символах
+func (t *terminal) size() (width, height int, err error) {
+	var ws winsize
+	if err = t.ioctl(syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return 0, 0, err
+	}
+
+	return int(ws.cols), int(ws.rows), nil
+}
+
+// restore возвращает терминал в исходный режим
+func (t *terminal) restore() error {
+	return t.ioctl(syscall.TCSETS, unsafe.Pointer(&t.state))
+}
+
+// ioctl выполняет системный вызов ioctl над терминалом
+func (t *terminal) ioctl(request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, t.fd, request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// errTerminalUnsupported Ошибка запуска полноэкранного интерфейса на платформе, где он не поддерживается
+var errTerminalUnsupported = errors.New("full-screen terminal UI is supported only on linux")
+
+// terminal терминал для полноэкранного интерфейса, на этой платформе не поддерживается
+type terminal struct{}
+
+// openTerminal сообщает, что полноэкранный интерфейс на этой платформе не поддерживается
+func openTerminal(*os.File) (*terminal, error) {
+	return nil, errTerminalUnsupported
+}
+
+// size не используется на этой платформе
+func (t *terminal) size() (width, height int, err error) {
+	return 0, 0, errTerminalUnsupported
+}
+
+// restore не используется на этой платформе
+func (t *terminal) restore() error {
+	return nil
+}
@@ -0,0 +1,766 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/phpCoder88/geekbrains-go2/duplicate-file-finder/duplicate"
+)
+
+// errTUIConflict Ошибка одновременного указания полноэкранного интерфейса и флагов, выбирающих действие над дубликатами
+var errTUIConflict = errors.New("tui chooses actions per file and conflicts with --action, -remove, --script and --interactive")
+
+// errTUINotTerminal Ошибка запуска полноэкранного интерфейса, когда ввод или вывод не терминал
+var errTUINotTerminal = errors.New("tui requires a terminal on stdin and stdout")
+
+// Размеры интерфейса по умолчанию, если размер терминала узнать не удалось
+const (
+	defaultTUIWidth  = 80
+	defaultTUIHeight = 24
+)
+
+// tuiPageSize количество строк, на которое перемещают курсор PgUp и PgDn
+const tuiPageSize = 10
+
+// tuiHelp подсказка по клавишам полноэкранного интерфейса
+const tuiHelp = "↑↓ выбор  Tab панель  k/d/h оставить/удалить/жесткая ссылка  a/A предложить  u сбросить  " +
+	"/ фильтр  s сортировка  Enter выполнить  q выход"
+
+// Управляющие последовательности терминала
+const (
+	escAltScreen    = "\033[?1049h"
+	escMainScreen   = "\033[?1049l"
+	escHideCursor   = "\033[?25l"
+	escShowCursor   = "\033[?25h"
+	escClear        = "\033[H\033[2J"
+	escReverse      = "\033[7m"
+	escBold         = "\033[1m"
+	escResetDisplay = "\033[0m"
+)
+
+// fileMark пометка файла в полноэкранном интерфейсе
+type fileMark int
+
+// Пометки файлов
+const (
+	markKeep fileMark = iota
+	markDelete
+	markHardlink
+)
+
+// String возвращает обозначение пометки в списке файлов
+func (m fileMark) String() string {
+	switch m {
+	case markDelete:
+		return "[D]"
+	case markHardlink:
+		return "[H]"
+	default:
+		return "[K]"
+	}
+}
+
+// tuiKey нажатая клавиша: символ или специальная клавиша
+type tuiKey struct {
+	r       rune
+	special specialKey
+}
+
+// specialKey специальная клавиша
+type specialKey int
+
+// Специальные клавиши
+const (
+	keyRune specialKey = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEnter
+	keyEsc
+	keyTab
+	keyBackspace
+	keyInterrupt
+)
+
+// escapeKeys специальные клавиши, которые терминал передает последовательностями после ESC
+var escapeKeys = map[string]specialKey{
+	"[A": keyUp, "OA": keyUp,
+	"[B": keyDown, "OB": keyDown,
+	"[C": keyRight, "OC": keyRight,
+	"[D": keyLeft, "OD": keyLeft,
+	"[H": keyHome, "OH": keyHome, "[1~": keyHome,
+	"[F": keyEnd, "OF": keyEnd, "[4~": keyEnd,
+	"[5~": keyPageUp,
+	"[6~": keyPageDown,
+}
+
+// parseKeys разбирает прочитанные из терминала байты на нажатые клавиши
+func parseKeys(buf []byte) []tuiKey {
+	var keys []tuiKey
+	for len(buf) > 0 {
+		switch buf[0] {
+		case '\033':
+			key, size := parseEscape(buf)
+			keys = append(keys, key)
+			buf = buf[size:]
+			continue
+		case '\r', '\n':
+			keys = append(keys, tuiKey{special: keyEnter})
+		case '\t':
+			keys = append(keys, tuiKey{special: keyTab})
+		case 0x7f, '\b':
+			keys = append(keys, tuiKey{special: keyBackspace})
+		case 0x03:
+			keys = append(keys, tuiKey{special: keyInterrupt})
+		default:
+			r, size := utf8.DecodeRune(buf)
+			keys = append(keys, tuiKey{r: r})
+			buf = buf[size:]
+			continue
+		}
+		buf = buf[1:]
+	}
+
+	return keys
+}
+
+// parseEscape разбирает последовательность, начинающуюся с ESC. Неизвестная последовательность считается нажатием ESC.
+func parseEscape(buf []byte) (tuiKey, int) {
+	for sequence, key := range escapeKeys {
+		if bytes.HasPrefix(buf[1:], []byte(sequence)) {
+			return tuiKey{special: key}, len(sequence) + 1
+		}
+	}
+
+	return tuiKey{special: keyEsc}, 1
+}
+
+// tuiGroup группа дубликатов с пометками файлов
+type tuiGroup struct {
+	group duplicate.Group
+	marks []fileMark
+}
+
+// planned возвращает true, если в группе есть файлы, помеченные для обработки
+func (g *tuiGroup) planned() bool {
+	for _, mark := range g.marks {
+		if mark != markKeep {
+			return true
+		}
+	}
+
+	return false
+}
+
+// review возвращает решения по группе для удаления и для замены жесткими ссылками.
+// Помеченные файлы, которые являются ссылками на оставляемые, не обрабатываются.
+func (g *tuiGroup) review() (remove, hardlink duplicate.Review, err error) {
+	var keep []int
+	marks := make(map[string]fileMark, len(g.marks))
+	for ind, mark := range g.marks {
+		if mark == markKeep {
+			keep = append(keep, ind)
+		}
+		marks[g.group.Files[ind].Path] = mark
+	}
+
+	review, err := duplicate.NewReview(g.group, keep)
+	if err != nil {
+		return remove, hardlink, err
+	}
+
+	remove.Kept, hardlink.Kept = review.Kept, review.Kept
+	for _, file := range review.Duplicates {
+		if marks[file.Path] == markHardlink {
+			hardlink.Duplicates = append(hardlink.Duplicates, file)
+			continue
+		}
+		remove.Duplicates = append(remove.Duplicates, file)
+	}
+
+	return remove, hardlink, nil
+}
+
+// tuiPane панель полноэкранного интерфейса
+type tuiPane int
+
+// Панели полноэкранного интерфейса
+const (
+	paneGroups tuiPane = iota
+	paneFiles
+)
+
+// tuiScreen экран полноэкранного интерфейса
+type tuiScreen int
+
+// Экраны полноэкранного интерфейса
+const (
+	screenBrowse tuiScreen = iota
+	screenFilter
+	screenConfirm
+)
+
+// browser состояние полноэкранного интерфейса просмотра групп дубликатов
+type browser struct {
+	groups  []*tuiGroup
+	visible []*tuiGroup
+
+	focus      tuiPane
+	screen     tuiScreen
+	groupInd   int
+	fileInd    int
+	groupFirst int
+	fileFirst  int
+
+	filter      string
+	filterInput string
+	byKey       bool
+	status      string
+
+	done     bool
+	approved bool
+}
+
+// newBrowser создает полноэкранный интерфейс для групп groups. Все файлы изначально помечены как оставляемые,
+// группы отсортированы по объему, который освободится после их обработки.
+func newBrowser(groups []duplicate.Group) *browser {
+	b := &browser{groups: make([]*tuiGroup, len(groups))}
+	for ind, group := range groups {
+		b.groups[ind] = &tuiGroup{group: group, marks: make([]fileMark, len(group.Files))}
+	}
+	b.refresh()
+
+	return b
+}
+
+// refresh заново отбирает группы по фильтру и сортирует их
+func (b *browser) refresh() {
+	filter := strings.ToLower(b.filter)
+	b.visible = b.visible[:0]
+	for _, group := range b.groups {
+		if filter == "" || groupContains(group.group, filter) {
+			b.visible = append(b.visible, group)
+		}
+	}
+
+	sort.SliceStable(b.visible, func(i, j int) bool {
+		left, right := b.visible[i].group, b.visible[j].group
+		if b.byKey {
+			return left.Key < right.Key
+		}
+		return left.WastedBytes() > right.WastedBytes()
+	})
+
+	b.groupInd, b.fileInd = 0, 0
+	b.groupFirst, b.fileFirst = 0, 0
+	b.focus = paneGroups
+}
+
+// groupContains возвращает true, если путь хотя бы одного файла группы содержит подстроку filter в нижнем регистре
+func groupContains(group duplicate.Group, filter string) bool {
+	for _, file := range group.Files {
+		if strings.Contains(strings.ToLower(file.Path), filter) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// current возвращает выбранную группу или nil, если групп нет
+func (b *browser) current() *tuiGroup {
+	if len(b.visible) == 0 {
+		return nil
+	}
+
+	return b.visible[b.groupInd]
+}
+
+// handleKey обрабатывает нажатую клавишу
+func (b *browser) handleKey(key tuiKey) {
+	if key.special == keyInterrupt {
+		b.done = true
+		return
+	}
+
+	switch b.screen {
+	case screenFilter:
+		b.handleFilterKey(key)
+	case screenConfirm:
+		b.handleConfirmKey(key)
+	default:
+		b.status = ""
+		b.handleBrowseKey(key)
+	}
+}
+
+// handleBrowseKey обрабатывает клавишу на экране просмотра групп
+func (b *browser) handleBrowseKey(key tuiKey) {
+	switch key.special {
+	case keyUp:
+		b.move(-1)
+	case keyDown:
+		b.move(1)
+	case keyPageUp:
+		b.move(-tuiPageSize)
+	case keyPageDown:
+		b.move(tuiPageSize)
+	case keyHome:
+		b.move(-len(b.groups))
+	case keyEnd:
+		b.move(len(b.groups))
+	case keyTab:
+		b.switchPane()
+	case keyLeft:
+		b.focus = paneGroups
+	case keyRight:
+		if b.current() != nil {
+			b.focus = paneFiles
+		}
+	case keyEnter:
+		b.confirm()
+	case keyRune:
+		b.handleBrowseRune(key.r)
+	}
+}
+
+// handleBrowseRune обрабатывает символьную клавишу на экране просмотра групп
+func (b *browser) handleBrowseRune(r rune) {
+	switch r {
+	case 'q':
+		b.done = true
+	case 'k':
+		b.mark(markKeep)
+	case 'd':
+		b.mark(markDelete)
+	case 'h':
+		b.mark(markHardlink)
+	case 'a':
+		if group := b.current(); group != nil {
+			propose(group)
+		}
+	case 'A':
+		for _, group := range b.visible {
+			propose(group)
+		}
+		b.status = fmt.Sprintf("Предложено удаление дубликатов в %d группах", len(b.visible))
+	case 'u':
+		if group := b.current(); group != nil {
+			group.marks = make([]fileMark, len(group.marks))
+		}
+	case 's':
+		b.byKey = !b.byKey
+		b.refresh()
+	case '/':
+		b.screen = screenFilter
+		b.filterInput = b.filter
+	case 'c':
+		b.confirm()
+	}
+}
+
+// handleFilterKey обрабатывает клавишу при вводе фильтра
+func (b *browser) handleFilterKey(key tuiKey) {
+	switch key.special {
+	case keyEnter:
+		b.filter = b.filterInput
+		b.screen = screenBrowse
+		b.refresh()
+	case keyEsc:
+		b.screen = screenBrowse
+	case keyBackspace:
+		if _, size := utf8.DecodeLastRuneInString(b.filterInput); size > 0 {
+			b.filterInput = b.filterInput[:len(b.filterInput)-size]
+		}
+	case keyRune:
+		b.filterInput += string(key.r)
+	}
+}
+
+// handleConfirmKey обрабатывает клавишу на экране подтверждения
+func (b *browser) handleConfirmKey(key tuiKey) {
+	switch {
+	case key.r == 'y' || key.r == 'Y':
+		b.approved, b.done = true, true
+	case key.r == 'q':
+		b.done = true
+	case key.r == 'n' || key.special == keyEsc:
+		b.screen = screenBrowse
+	}
+}
+
+// move перемещает курсор в активной панели на delta строк
+func (b *browser) move(delta int) {
+	group := b.current()
+	if group == nil {
+		return
+	}
+
+	if b.focus == paneFiles {
+		b.fileInd = clamp(b.fileInd+delta, len(group.marks))
+		return
+	}
+
+	b.groupInd = clamp(b.groupInd+delta, len(b.visible))
+	b.fileInd, b.fileFirst = 0, 0
+}
+
+// clamp ограничивает номер строки ind диапазоном [0, size)
+func clamp(ind, size int) int {
+	if ind >= size {
+		ind = size - 1
+	}
+	if ind < 0 {
+		ind = 0
+	}
+
+	return ind
+}
+
+// switchPane переключает активную панель
+func (b *browser) switchPane() {
+	if b.focus == paneFiles || b.current() == nil {
+		b.focus = paneGroups
+		return
+	}
+
+	b.focus = paneFiles
+}
+
+// mark помечает выбранный файл. В группе должен остаться хотя бы один файл, найденный не по символической ссылке.
+func (b *browser) mark(mark fileMark) {
+	group := b.current()
+	if group == nil {
+		return
+	}
+	if b.focus != paneFiles {
+		b.status = "Выберите файл: Tab - перейти к списку файлов"
+		return
+	}
+
+	previous := group.marks[b.fileInd]
+	group.marks[b.fileInd] = mark
+	if _, _, err := group.review(); err != nil {
+		group.marks[b.fileInd] = previous
+		b.status = "В группе должен остаться хотя бы один файл, найденный не по символической ссылке"
+	}
+}
+
+// propose помечает файлы группы по предложенному правилами --keep решению: первый файл остается, остальные удаляются
+func propose(group *tuiGroup) {
+	for ind := range group.marks {
+		group.marks[ind] = markDelete
+	}
+	group.marks[0] = markKeep
+}
+
+// confirm переходит к экрану подтверждения, если есть помеченные для обработки файлы
+func (b *browser) confirm() {
+	for _, group := range b.groups {
+		if group.planned() {
+			b.screen = screenConfirm
+			return
+		}
+	}
+
+	b.status = "Нет файлов, помеченных для удаления или замены жесткой ссылкой"
+}
+
+// plan возвращает действия над помеченными файлами всех групп, в том числе не прошедших фильтр
+func (b *browser) plan() []actionPlan {
+	removes := make(map[string]duplicate.Review)
+	hardlinks := make(map[string]duplicate.Review)
+	for _, group := range b.groups {
+		if !group.planned() {
+			continue
+		}
+
+		remove, hardlink, err := group.review()
+		if err != nil {
+			continue
+		}
+		if len(remove.Duplicates) > 0 {
+			removes[group.group.Key] = remove
+		}
+		if len(hardlink.Duplicates) > 0 {
+			hardlinks[group.group.Key] = hardlink
+		}
+	}
+
+	var plans []actionPlan
+	if len(hardlinks) > 0 {
+		plans = append(plans, actionPlan{action: duplicate.HardlinkAction{}, reviews: hardlinks})
+	}
+	if len(removes) > 0 {
+		plans = append(plans, actionPlan{action: duplicate.RemoveAction{}, reviews: removes})
+	}
+
+	return plans
+}
+
+// render выводит экран интерфейса размером width на height символов
+func (b *browser) render(out io.Writer, width, height int) {
+	screen := new(bytes.Buffer)
+	screen.WriteString(escClear)
+	if b.screen == screenConfirm {
+		b.renderConfirm(screen, width)
+	} else {
+		b.renderBrowse(screen, width, height)
+	}
+
+	_, _ = out.Write(screen.Bytes())
+}
+
+// renderBrowse выводит экран просмотра групп: заголовок, список групп, список файлов выбранной группы,
+// сведения о выбранном файле, строку состояния и подсказку
+func (b *browser) renderBrowse(out *bytes.Buffer, width, height int) {
+	const detailsRows = 5
+	const chromeRows = 5
+	rows := height - detailsRows - chromeRows
+	if rows < 1 {
+		rows = 1
+	}
+
+	order := "по объему"
+	if b.byKey {
+		order = "по ключу"
+	}
+	writeLine(out, fmt.Sprintf("Групп: %d из %d   фильтр: %q   сортировка: %s", len(b.visible), len(b.groups), b.filter, order),
+		width, escBold)
+	writeLine(out, strings.Repeat("─", width), width, "")
+
+	groupsWidth := width * 2 / 5
+	filesWidth := width - groupsWidth - 3
+	groupLines := b.groupLines(rows, groupsWidth)
+	fileLines := b.fileLines(rows, filesWidth)
+	for ind := 0; ind < rows; ind++ {
+		out.WriteString(groupLines[ind])
+		out.WriteString(" │ ")
+		out.WriteString(fileLines[ind])
+		out.WriteString("\n")
+	}
+
+	writeLine(out, strings.Repeat("─", width), width, "")
+	details := b.details()
+	for ind := 0; ind < detailsRows; ind++ {
+		line := ""
+		if ind < len(details) {
+			line = details[ind]
+		}
+		writeLine(out, line, width, "")
+	}
+
+	writeLine(out, strings.Repeat("─", width), width, "")
+	switch {
+	case b.screen == screenFilter:
+		writeLine(out, "Фильтр по пути (Enter - применить, Esc - отменить): "+b.filterInput, width, "")
+	default:
+		writeLine(out, b.status, width, escBold)
+	}
+	out.WriteString(fit(tuiHelp, width))
+}
+
+// groupLines возвращает rows строк списка групп шириной width
+func (b *browser) groupLines(rows, width int) []string {
+	b.groupFirst = scroll(b.groupFirst, b.groupInd, rows)
+	lines := make([]string, rows)
+	for row := range lines {
+		ind := b.groupFirst + row
+		if ind >= len(b.visible) {
+			lines[row] = fit("", width)
+			continue
+		}
+
+		group := b.visible[ind]
+		planned := " "
+		if group.planned() {
+			planned = "*"
+		}
+		line := fmt.Sprintf("%s%9s %3d %s", planned, duplicate.FormatBytes(group.group.WastedBytes()), len(group.marks), group.group.Key)
+		lines[row] = highlight(fit(line, width), ind == b.groupInd, b.focus == paneGroups)
+	}
+
+	return lines
+}
+
+// fileLines возвращает rows строк списка файлов выбранной группы шириной width
+func (b *browser) fileLines(rows, width int) []string {
+	lines := make([]string, rows)
+	group := b.current()
+	if group != nil {
+		b.fileFirst = scroll(b.fileFirst, b.fileInd, rows)
+	}
+	for row := range lines {
+		ind := b.fileFirst + row
+		if group == nil || ind >= len(group.marks) {
+			lines[row] = fit("", width)
+			continue
+		}
+
+		file := group.group.Files[ind]
+		line := group.marks[ind].String() + " " + file.Path
+		if file.Symlink {
+			line += " ->"
+		}
+		lines[row] = highlight(fit(line, width), ind == b.fileInd, b.focus == paneFiles)
+	}
+
+	return lines
+}
+
+// details возвращает сведения о выбранном файле
+func (b *browser) details() []string {
+	group := b.current()
+	if group == nil {
+		return []string{"Нет групп, подходящих под фильтр"}
+	}
+
+	file := group.group.Files[b.fileInd]
+	details := []string{
+		"Путь:      " + file.Path,
+		fmt.Sprintf("Размер:    %s (%d байт)", duplicate.FormatBytes(file.Size), file.Size),
+		"Изменен:   " + file.ModTime.Format("2006-01-02 15:04:05"),
+		"Стартовая: " + file.Root,
+	}
+	if file.Hash != "" {
+		details = append(details, "SHA-256:   "+file.Hash)
+	}
+
+	return details
+}
+
+// renderConfirm выводит экран подтверждения со сводкой помеченных файлов
+func (b *browser) renderConfirm(out *bytes.Buffer, width int) {
+	var removes, hardlinks, groups int
+	var reclaimable int64
+	for _, group := range b.groups {
+		if !group.planned() {
+			continue
+		}
+
+		remove, hardlink, err := group.review()
+		if err != nil {
+			continue
+		}
+		groups++
+		removes += len(remove.Duplicates)
+		hardlinks += len(hardlink.Duplicates)
+		processed := duplicate.Review{Kept: remove.Kept}
+		processed.Duplicates = append(processed.Duplicates, remove.Duplicates...)
+		processed.Duplicates = append(processed.Duplicates, hardlink.Duplicates...)
+		reclaimable += processed.WastedBytes()
+	}
+
+	writeLine(out, "Подтверждение", width, escBold)
+	writeLine(out, "", width, "")
+	writeLine(out, fmt.Sprintf("Групп с помеченными файлами:  %d", groups), width, "")
+	writeLine(out, fmt.Sprintf("Удалить файлов:               %d", removes), width, "")
+	writeLine(out, fmt.Sprintf("Заменить жесткими ссылками:   %d", hardlinks), width, "")
+	writeLine(out, "Освободится:                  "+duplicate.FormatBytes(reclaimable), width, "")
+	writeLine(out, "", width, "")
+	writeLine(out, "Выполнить? y - да, n - вернуться к списку, q - выйти без изменений", width, "")
+}
+
+// scroll возвращает первую показываемую строку списка высотой rows, при которой видна строка cursor
+func scroll(first, cursor, rows int) int {
+	if cursor < first {
+		return cursor
+	}
+	if cursor >= first+rows {
+		return cursor - rows + 1
+	}
+
+	return first
+}
+
+// fit обрезает строку s до width символов или дополняет ее пробелами
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+
+	length := utf8.RuneCountInString(s)
+	if length <= width {
+		return s + strings.Repeat(" ", width-length)
+	}
+
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+// highlight выделяет выбранную строку: в активной панели инверсией, в неактивной жирным шрифтом
+func highlight(line string, selected, focused bool) string {
+	switch {
+	case !selected:
+		return line
+	case focused:
+		return escReverse + line + escResetDisplay
+	default:
+		return escBold + line + escResetDisplay
+	}
+}
+
+// writeLine выводит строку line шириной width с оформлением style
+func writeLine(out *bytes.Buffer, line string, width int, style string) {
+	if style != "" {
+		out.WriteString(style + fit(line, width) + escResetDisplay + "\n")
+		return
+	}
+
+	out.WriteString(fit(line, width) + "\n")
+}
+
+// browseGroups показывает группы дубликатов в полноэкранном интерфейсе терминала in и out.
+// Возвращает действия над помеченными файлами, если пользователь подтвердил их выполнение.
+func browseGroups(in, out *os.File, groups []duplicate.Group) ([]actionPlan, error) {
+	term, err := openTerminal(in)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = term.restore()
+	}()
+
+	_, _ = fmt.Fprint(out, escAltScreen+escHideCursor)
+	defer func() {
+		_, _ = fmt.Fprint(out, escShowCursor+escMainScreen)
+	}()
+
+	b := newBrowser(groups)
+	buf := make([]byte, 64)
+	for !b.done {
+		width, height, sizeErr := term.size()
+		if sizeErr != nil || width <= 0 || height <= 0 {
+			width, height = defaultTUIWidth, defaultTUIHeight
+		}
+		b.render(out, width, height)
+
+		n, readErr := in.Read(buf)
+		if readErr != nil {
+			return nil, readErr
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			b.handleKey(key)
+			if b.done {
+				break
+			}
+		}
+	}
+
+	if !b.approved {
+		return nil, nil
+	}
+
+	return b.plan(), nil
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/phpCoder88/geekbrains-go2/duplicate-file-finder/duplicate"
+)
+
+// Последовательности клавиш терминала
+const (
+	up       = "\033[A"
+	down     = "\033[B"
+	right    = "\033[C"
+	left     = "\033[D"
+	pageUp   = "\033[5~"
+	pageDown = "\033[6~"
+	home     = "\033[H"
+	end      = "\033[F"
+	esc      = "\033"
+	enter    = "\r"
+	tab      = "\t"
+)
+
+// testGroups группы дубликатов, которые по объему идут в порядке c-big, a-mid, b-small, а по ключу - a-mid, b-small, c-big
+func testGroups() []duplicate.Group {
+	return []duplicate.Group{
+		{Key: "b-small", Files: []duplicate.File{
+			{Name: "s.txt", Path: "a/s.txt", Size: 10},
+			{Name: "s.txt", Path: "b/s.txt", Size: 10, Symlink: true},
+		}},
+		{Key: "c-big", Files: []duplicate.File{
+			{Name: "big.bin", Path: "a/big.bin", Size: 100},
+			{Name: "big.bin", Path: "b/big.bin", Size: 100},
+			{Name: "big.bin", Path: "c/big.bin", Size: 100},
+		}},
+		{Key: "a-mid", Files: []duplicate.File{
+			{Name: "mid.txt", Path: "a/mid.txt", Size: 50},
+			{Name: "mid.txt", Path: "b/mid.txt", Size: 50},
+		}},
+	}
+}
+
+// press передает интерфейсу b клавиши из input, пока он не завершится
+func press(b *browser, input string) {
+	for _, key := range parseKeys([]byte(input)) {
+		b.handleKey(key)
+		if b.done {
+			return
+		}
+	}
+}
+
+// planPaths возвращает обрабатываемые файлы планов по действиям
+func planPaths(plans []actionPlan) map[string][]string {
+	paths := make(map[string][]string)
+	for _, plan := range plans {
+		for _, review := range plan.reviews {
+			for _, file := range review.Duplicates {
+				paths[plan.action.String()] = append(paths[plan.action.String()], file.Path)
+			}
+		}
+		sort.Strings(paths[plan.action.String()])
+	}
+
+	return paths
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []tuiKey
+	}{
+		{name: "Empty", input: "", want: nil},
+		{name: "Runes", input: "dя/", want: []tuiKey{{r: 'd'}, {r: 'я'}, {r: '/'}}},
+		{
+			name:  "Control",
+			input: "\r\n\t\x7f\b\x03",
+			want: []tuiKey{
+				{special: keyEnter}, {special: keyEnter}, {special: keyTab},
+				{special: keyBackspace}, {special: keyBackspace}, {special: keyInterrupt},
+			},
+		},
+		{
+			name:  "Arrows",
+			input: up + "\033OB" + right + "\033OD",
+			want:  []tuiKey{{special: keyUp}, {special: keyDown}, {special: keyRight}, {special: keyLeft}},
+		},
+		{
+			name:  "Navigation",
+			input: pageUp + pageDown + "\033[1~" + "\033[4~" + home + "\033OF",
+			want: []tuiKey{
+				{special: keyPageUp}, {special: keyPageDown}, {special: keyHome},
+				{special: keyEnd}, {special: keyHome}, {special: keyEnd},
+			},
+		},
+		{name: "Escape", input: esc, want: []tuiKey{{special: keyEsc}}},
+		{name: "Unknown Escape", input: "\033[Zx", want: []tuiKey{{special: keyEsc}, {r: '['}, {r: 'Z'}, {r: 'x'}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseKeys([]byte(tt.input)))
+		})
+	}
+}
+
+func TestBrowserNavigation(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantGroup string
+		wantFile  int
+		wantFocus tuiPane
+	}{
+		{name: "Initial", input: "", wantGroup: "c-big"},
+		{name: "Down", input: down, wantGroup: "a-mid"},
+		{name: "Down Clamped", input: down + down + down, wantGroup: "b-small"},
+		{name: "Up Clamped", input: down + up + up, wantGroup: "c-big"},
+		{name: "Page Down", input: pageDown, wantGroup: "b-small"},
+		{name: "Page Up", input: pageDown + pageUp, wantGroup: "c-big"},
+		{name: "End", input: end, wantGroup: "b-small"},
+		{name: "Home", input: end + home, wantGroup: "c-big"},
+		{name: "Files Pane", input: tab + down, wantGroup: "c-big", wantFile: 1, wantFocus: paneFiles},
+		{name: "Files Clamped", input: tab + end + down, wantGroup: "c-big", wantFile: 2, wantFocus: paneFiles},
+		{name: "Right And Left", input: right + down + left + down, wantGroup: "a-mid"},
+		{name: "Group Change Resets File", input: tab + down + tab + down, wantGroup: "a-mid"},
+		{name: "Sort By Key", input: down + "s", wantGroup: "a-mid"},
+		{name: "Sort Back By Size", input: "s" + down + "s", wantGroup: "c-big"},
+		{name: "Filter", input: "/MID" + enter, wantGroup: "a-mid"},
+		{name: "Filter Backspace", input: "/midx\x7f\x7f\x7f\x7f" + enter, wantGroup: "c-big"},
+		{name: "Filter Cancelled", input: "/mid" + esc, wantGroup: "c-big"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBrowser(testGroups())
+			press(b, tt.input)
+
+			require.NotNil(t, b.current())
+			assert.Equal(t, tt.wantGroup, b.current().group.Key)
+			assert.Equal(t, tt.wantFile, b.fileInd)
+			assert.Equal(t, tt.wantFocus, b.focus)
+			assert.Equal(t, screenBrowse, b.screen)
+			assert.False(t, b.done)
+		})
+	}
+
+	b := newBrowser(testGroups())
+	press(b, "/nothing"+enter+tab+"d")
+	assert.Nil(t, b.current())
+	assert.Equal(t, paneGroups, b.focus)
+	assert.Equal(t, []string{"Нет групп, подходящих под фильтр"}, b.details())
+}
+
+func TestScroll(t *testing.T) {
+	tests := []struct {
+		first, cursor, rows int
+		want                int
+	}{
+		{first: 0, cursor: 0, rows: 3, want: 0},
+		{first: 0, cursor: 2, rows: 3, want: 0},
+		{first: 0, cursor: 3, rows: 3, want: 1},
+		{first: 0, cursor: 9, rows: 3, want: 7},
+		{first: 5, cursor: 4, rows: 3, want: 4},
+		{first: 5, cursor: 6, rows: 3, want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d,%d,%d", tt.first, tt.cursor, tt.rows), func(t *testing.T) {
+			assert.Equal(t, tt.want, scroll(tt.first, tt.cursor, tt.rows))
+		})
+	}
+}
+
+func TestBrowserScrolling(t *testing.T) {
+	files := make([]duplicate.File, 10)
+	for ind := range files {
+		files[ind] = duplicate.File{Path: fmt.Sprintf("f%d", ind), Size: 1}
+	}
+	groups := make([]duplicate.Group, 20)
+	for ind := range groups {
+		groups[ind] = duplicate.Group{Key: fmt.Sprintf("g%02d", ind), Files: files}
+	}
+
+	// Высота 13 оставляет под списки 3 строки
+	const width, height = 80, 13
+	tests := []struct {
+		name           string
+		input          string
+		wantGroupFirst int
+		wantFileFirst  int
+		wantVisible    string
+	}{
+		{name: "Initial", input: "", wantVisible: "g02"},
+		{name: "Below Window", input: down + down + down, wantGroupFirst: 1, wantVisible: "g03"},
+		{name: "End", input: end, wantGroupFirst: 17, wantVisible: "g19"},
+		{name: "Back Home", input: end + home, wantVisible: "g00"},
+		{name: "Files End", input: tab + end, wantFileFirst: 7, wantVisible: "f9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBrowser(groups)
+			for _, key := range parseKeys([]byte(tt.input)) {
+				b.handleKey(key)
+				b.render(new(bytes.Buffer), width, height)
+			}
+
+			out := new(bytes.Buffer)
+			b.render(out, width, height)
+			assert.Equal(t, tt.wantGroupFirst, b.groupFirst)
+			assert.Equal(t, tt.wantFileFirst, b.fileFirst)
+			assert.Contains(t, out.String(), tt.wantVisible)
+		})
+	}
+}
+
+func TestBrowserPlan(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		wantScreen   tuiScreen
+		wantDone     bool
+		wantApproved bool
+		wantStatus   string
+		want         map[string][]string
+	}{
+		{
+			name:         "Propose All",
+			input:        "A" + enter + "y",
+			wantScreen:   screenConfirm,
+			wantDone:     true,
+			wantApproved: true,
+			want:         map[string][]string{"remove": {"b/big.bin", "b/mid.txt", "b/s.txt", "c/big.bin"}},
+		},
+		{
+			name:         "Hardlink And Delete",
+			input:        tab + down + "h" + down + "d" + "c" + "Y",
+			wantScreen:   screenConfirm,
+			wantDone:     true,
+			wantApproved: true,
+			want:         map[string][]string{"hardlink": {"b/big.bin"}, "remove": {"c/big.bin"}},
+		},
+		{
+			name:         "Mark Changed Back",
+			input:        tab + down + "d" + "k" + down + "d" + enter + "y",
+			wantScreen:   screenConfirm,
+			wantDone:     true,
+			wantApproved: true,
+			want:         map[string][]string{"remove": {"c/big.bin"}},
+		},
+		{
+			name:         "Reset Group",
+			input:        "A" + "u" + enter + "y",
+			wantScreen:   screenConfirm,
+			wantDone:     true,
+			wantApproved: true,
+			want:         map[string][]string{"remove": {"b/mid.txt", "b/s.txt"}},
+		},
+		{
+			name:         "Marks Outside Filter",
+			input:        tab + "d" + "/s.txt" + enter + "A" + enter + "y",
+			wantScreen:   screenConfirm,
+			wantDone:     true,
+			wantApproved: true,
+			want:         map[string][]string{"remove": {"a/big.bin", "b/s.txt"}},
+		},
+		{
+			name:       "Confirm Screen",
+			input:      "A" + enter,
+			wantScreen: screenConfirm,
+			want:       map[string][]string{"remove": {"b/big.bin", "b/mid.txt", "b/s.txt", "c/big.bin"}},
+		},
+		{
+			name:  "Declined",
+			input: "A" + enter + "n",
+			want:  map[string][]string{"remove": {"b/big.bin", "b/mid.txt", "b/s.txt", "c/big.bin"}},
+		},
+		{
+			name:  "Escape From Confirm",
+			input: "A" + enter + esc,
+			want:  map[string][]string{"remove": {"b/big.bin", "b/mid.txt", "b/s.txt", "c/big.bin"}},
+		},
+		{
+			name:       "Quit From Confirm",
+			input:      "A" + enter + "q",
+			wantScreen: screenConfirm,
+			wantDone:   true,
+			want:       map[string][]string{"remove": {"b/big.bin", "b/mid.txt", "b/s.txt", "c/big.bin"}},
+		},
+		{
+			name:       "Interrupt",
+			input:      "A" + "\x03",
+			wantDone:   true,
+			wantStatus: "Предложено удаление дубликатов в 3 группах",
+			want:       map[string][]string{"remove": {"b/big.bin", "b/mid.txt", "b/s.txt", "c/big.bin"}},
+		},
+		{
+			name:       "Nothing Marked",
+			input:      enter,
+			wantStatus: "Нет файлов, помеченных для удаления или замены жесткой ссылкой",
+			want:       map[string][]string{},
+		},
+		{
+			name:       "Mark In Groups Pane",
+			input:      "d",
+			wantStatus: "Выберите файл: Tab - перейти к списку файлов",
+			want:       map[string][]string{},
+		},
+		{
+			name:       "Symlink Not Kept Alone",
+			input:      end + tab + "d",
+			wantStatus: "В группе должен остаться хотя бы один файл, найденный не по символической ссылке",
+			want:       map[string][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBrowser(testGroups())
+			press(b, tt.input)
+
+			assert.Equal(t, tt.wantScreen, b.screen)
+			assert.Equal(t, tt.wantDone, b.done)
+			assert.Equal(t, tt.wantApproved, b.approved)
+			assert.Equal(t, tt.wantStatus, b.status)
+			assert.Equal(t, tt.want, planPaths(b.plan()))
+		})
+	}
+}
+
+func TestBrowserConfirm(t *testing.T) {
+	b := newBrowser(testGroups())
+	press(b, tab+down+"h"+down+"d"+left+down+"a")
+	require.Equal(t, screenBrowse, b.screen)
+
+	press(b, enter)
+	require.Equal(t, screenConfirm, b.screen)
+
+	out := new(bytes.Buffer)
+	b.render(out, 80, 24)
+	screen := out.String()
+	assert.Contains(t, screen, "Групп с помеченными файлами:  2")
+	assert.Contains(t, screen, "Удалить файлов:               2")
+	assert.Contains(t, screen, "Заменить жесткими ссылками:   1")
+	assert.Contains(t, screen, "Освободится:                  250 B")
+
+	// Пока действие не подтверждено, нажатия вне экрана подтверждения не обрабатываются
+	press(b, "d")
+	assert.Equal(t, screenConfirm, b.screen)
+	assert.False(t, b.done)
+
+	press(b, "y")
+	assert.True(t, b.done)
+	assert.True(t, b.approved)
+
+	plans := b.plan()
+	require.Len(t, plans, 2)
+	assert.Equal(t, duplicate.HardlinkAction{}.String(), plans[0].action.String())
+	assert.Equal(t, duplicate.RemoveAction{}.String(), plans[1].action.String())
+	for _, plan := range plans {
+		for key, review := range plan.reviews {
+			require.Len(t, review.Kept, 1, key)
+			assert.True(t, strings.HasPrefix(review.Kept[0].Path, "a/"), key)
+		}
+	}
+}
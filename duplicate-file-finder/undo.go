@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/phpCoder88/geekbrains-go2/duplicate-file-finder/duplicate"
+)
+
+// openJournal открывает журнал действий над дубликатами на дозапись
+func openJournal(journalPath string) (*duplicate.Journal, io.Closer, error) {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return duplicate.NewJournal(file, workDir), file, nil
+}
+
+// runUndo команда undo: отменяет действия из журнала в обратном порядке
+func runUndo(args []string) int {
+	flags := flag.NewFlagSet("undo", flag.ExitOnError)
+	journalPath := flags.String("journal", "", "файл журнала действий над дубликатами")
+	_ = flags.Parse(args)
+
+	if *journalPath == "" {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := os.Open(*journalPath)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	entries, err := duplicate.ReadJournal(file)
+	_ = file.Close()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	result := duplicate.Undo(duplicate.FileSystem{}, entries)
+	for _, entry := range result.Undone {
+		fmt.Printf("undone %s %s\n", entry.Action, entry.Removed)
+	}
+
+	for _, failed := range result.Failed {
+		_, _ = fmt.Fprintf(os.Stderr, "not undone %s %s: %v\n", failed.Entry.Action, failed.Entry.Removed, failed.Reason)
+	}
+
+	if err = pruneManifests(result.Undone); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if len(result.Failed) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// pruneManifests удаляет из манифестов карантина записи файлов, которые вернула из карантина отмена действий undone
+func pruneManifests(undone []duplicate.JournalEntry) error {
+	trashes := make(map[string]bool)
+	for _, entry := range undone {
+		if entry.Trash != "" {
+			trashes[entry.Trash] = true
+		}
+	}
+
+	for trash := range trashes {
+		manifestPath := filepath.Join(trash, duplicate.QuarantineManifest)
+		entries, err := readManifest(manifestPath)
+		if err != nil {
+			return err
+		}
+
+		if err = writeManifest(manifestPath, duplicate.PruneManifest(entries, undone)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
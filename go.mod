@@ -3,7 +3,7 @@ module github.com/phpCoder88/geekbrains-go2
 go 1.16
 
 require (
-	github.com/stretchr/testify v1.7.0 // indirect
-	go.uber.org/multierr v1.6.0 // indirect
-	go.uber.org/zap v1.16.0 // indirect
+	github.com/stretchr/testify v1.7.0
+	go.uber.org/multierr v1.6.0
+	go.uber.org/zap v1.16.0
 )